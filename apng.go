@@ -0,0 +1,222 @@
+package aseprite
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"io"
+	"time"
+)
+
+// EncodeAPNG writes the animation of a tag to w as an animated PNG.
+// If tag is nil, the animation plays all frames forward and loops forever.
+// The frames are played in the same order as GIF.
+// Frames are stored as 8-bit RGBA images with millisecond delays.
+func EncodeAPNG(w io.Writer, spr *Aseprite, tag *Tag) error {
+	seq, loopCount, err := animation(spr, tag)
+	if err != nil {
+		return err
+	}
+
+	// convert gif.GIF.LoopCount to the number of plays
+	plays := 0
+	if loopCount != 0 {
+		plays = loopCount + 1
+		if loopCount < 0 {
+			plays = 1
+		}
+	}
+
+	size := spr.Frames[seq[0]].Size
+	e := apngEncoder{w: w}
+	_, e.err = io.WriteString(w, pngHeader)
+
+	var ihdr [13]byte
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(size.X))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(size.Y))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // truecolor with alpha
+	e.writeChunk("IHDR", ihdr[:])
+
+	var actl [8]byte
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(seq)))
+	binary.BigEndian.PutUint32(actl[4:], uint32(plays))
+	e.writeChunk("acTL", actl[:])
+
+	// compress every frame only once
+	compressed := make(map[int][]byte)
+
+	for j, i := range seq {
+		data, ok := compressed[i]
+		if !ok {
+			if data, err = compressFrame(spriteFrame(spr, i)); err != nil {
+				return err
+			}
+			compressed[i] = data
+		}
+
+		num, den := apngDelay(spr.Frames[i].Duration)
+
+		var fctl [26]byte
+		binary.BigEndian.PutUint32(fctl[0:], e.nextSeq())
+		binary.BigEndian.PutUint32(fctl[4:], uint32(size.X))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(size.Y))
+		binary.BigEndian.PutUint16(fctl[20:], num)
+		binary.BigEndian.PutUint16(fctl[22:], den)
+		// the frame replaces the entire canvas,
+		// so the dispose and blend operations are none and source
+		e.writeChunk("fcTL", fctl[:])
+
+		// the first frame is also the default image
+		if j == 0 {
+			e.writeChunk("IDAT", data)
+		} else {
+			var seqnum [4]byte
+			binary.BigEndian.PutUint32(seqnum[:], e.nextSeq())
+			e.writeChunk("fdAT", append(seqnum[:], data...))
+		}
+	}
+
+	e.writeChunk("IEND", nil)
+	return e.err
+}
+
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+// apngDelay converts d to a frame delay fraction in seconds.
+func apngDelay(d time.Duration) (num, den uint16) {
+	if ms := d.Milliseconds(); ms <= 0xffff {
+		return uint16(ms), 1000
+	}
+	if cs := (d + 5*time.Millisecond) / (10 * time.Millisecond); cs <= 0xffff {
+		return uint16(cs), 100
+	}
+	return 0xffff, 100
+}
+
+type apngEncoder struct {
+	w   io.Writer
+	seq uint32
+	err error
+}
+
+func (e *apngEncoder) nextSeq() uint32 {
+	e.seq++
+	return e.seq - 1
+}
+
+// writeChunk writes a chunk of the given type and data.
+func (e *apngEncoder) writeChunk(typ string, data []byte) {
+	if e.err != nil {
+		return
+	}
+
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(data)))
+	copy(hdr[4:], typ)
+
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write(hdr[4:])
+	_, _ = crc.Write(data)
+
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+
+	for _, b := range [][]byte{hdr[:], data, footer[:]} {
+		if _, e.err = e.w.Write(b); e.err != nil {
+			return
+		}
+	}
+}
+
+// compressFrame filters and compresses the pixels of img as PNG image data.
+func compressFrame(img *image.NRGBA) ([]byte, error) {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+
+	n := 4 * img.Rect.Dx()
+	prev := make([]byte, n)
+	var filtered [5][]byte
+	for i := range filtered {
+		filtered[i] = make([]byte, 1+n)
+		filtered[i][0] = byte(i)
+	}
+
+	for y := 0; y < img.Rect.Dy(); y++ {
+		i := img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y)
+		row := img.Pix[i : i+n]
+		best := filterRow(&filtered, row, prev, 4)
+		if _, err := zw.Write(filtered[best]); err != nil {
+			return nil, err
+		}
+		prev = row
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// filterRow applies all five PNG filters to row and returns the filter
+// that minimizes the sum of absolute differences, the same heuristic as image/png.
+func filterRow(filtered *[5][]byte, row, prev []byte, bpp int) int {
+	best, bestSum := 0, -1
+	for f := range filtered {
+		dst := filtered[f][1:]
+		sum := 0
+		for i, x := range row {
+			var a, b, c byte
+			if i >= bpp {
+				a, c = row[i-bpp], prev[i-bpp]
+			}
+			b = prev[i]
+
+			switch f {
+			case 0:
+				dst[i] = x
+			case 1:
+				dst[i] = x - a
+			case 2:
+				dst[i] = x - b
+			case 3:
+				dst[i] = x - byte((int(a)+int(b))/2)
+			case 4:
+				dst[i] = x - paeth(a, b, c)
+			}
+
+			if d := int8(dst[i]); d < 0 {
+				sum -= int(d)
+			} else {
+				sum += int(d)
+			}
+		}
+
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = f, sum
+		}
+	}
+	return best
+}
+
+// paeth implements the Paeth predictor function of the PNG specification.
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,127 @@
+package aseprite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+func readPNGChunks(t *testing.T, raw []byte) []pngChunk {
+	require.True(t, string(raw[:8]) == pngHeader, "header")
+	raw = raw[8:]
+
+	var chunks []pngChunk
+	for len(raw) > 0 {
+		n := binary.BigEndian.Uint32(raw)
+		c := pngChunk{string(raw[4:8]), raw[8 : 8+n]}
+		crc := binary.BigEndian.Uint32(raw[8+n:])
+		require.True(t, crc == crc32.ChecksumIEEE(raw[4:8+n]), "crc", c.typ)
+		chunks = append(chunks, c)
+		raw = raw[12+n:]
+	}
+	return chunks
+}
+
+// framePNG returns a PNG image that contains only the image data of an APNG frame.
+func framePNG(ihdr, data []byte) []byte {
+	var b bytes.Buffer
+	e := apngEncoder{w: &b}
+	b.WriteString(pngHeader)
+	e.writeChunk("IHDR", ihdr)
+	e.writeChunk("IDAT", data)
+	e.writeChunk("IEND", nil)
+	return b.Bytes()
+}
+
+func TestEncodeAPNG(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/slime_grayscale.aseprite")
+	require.NoError(t, err)
+
+	spr, err := ReadWithOptions(bytes.NewReader(raw), &Options{Trim: true})
+	require.NoError(t, err)
+
+	spr.Frames[1].Duration = 123 * time.Millisecond
+
+	tag := spr.Tags[0]
+	var b bytes.Buffer
+	require.NoError(t, EncodeAPNG(&b, spr, &tag))
+
+	// APNG files are valid PNG files that show the first frame
+	img, err := png.Decode(bytes.NewReader(b.Bytes()))
+	require.NoError(t, err)
+	require.True(t, img.Bounds().Size() == image.Pt(32, 64), "size")
+
+	chunks := readPNGChunks(t, b.Bytes())
+	require.True(t, chunks[0].typ == "IHDR" && chunks[1].typ == "acTL", "chunk order")
+	require.True(t, chunks[len(chunks)-1].typ == "IEND", "last chunk")
+
+	// ping-pong over frames 0-3
+	wantSeq := []int{0, 1, 2, 3, 2, 1}
+	nframes := binary.BigEndian.Uint32(chunks[1].data)
+	plays := binary.BigEndian.Uint32(chunks[1].data[4:])
+	require.True(t, nframes == uint32(len(wantSeq)) && plays == 0, "acTL", nframes, plays)
+
+	var seqnum uint32
+	var frame int
+	for i := 2; i < len(chunks)-1; i += 2 {
+		fctl, dat := chunks[i], chunks[i+1]
+		require.True(t, fctl.typ == "fcTL", "fcTL", i)
+		require.True(t, binary.BigEndian.Uint32(fctl.data) == seqnum, "fcTL sequence", i)
+		seqnum++
+
+		fr := spr.Frames[wantSeq[frame]]
+		num, den := binary.BigEndian.Uint16(fctl.data[20:]), binary.BigEndian.Uint16(fctl.data[22:])
+		require.True(t, time.Duration(num)*time.Second/time.Duration(den) == fr.Duration, "delay", frame, num, den)
+
+		data := dat.data
+		if frame == 0 {
+			require.True(t, dat.typ == "IDAT", "IDAT")
+		} else {
+			require.True(t, dat.typ == "fdAT", "fdAT", i)
+			require.True(t, binary.BigEndian.Uint32(data) == seqnum, "fdAT sequence", i)
+			data = data[4:]
+			seqnum++
+		}
+
+		img, err := png.Decode(bytes.NewReader(framePNG(chunks[0].data, data)))
+		require.NoError(t, err)
+
+		want := spriteFrame(spr, wantSeq[frame])
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 32; x++ {
+				require.True(t, img.At(x, y) == want.At(x, y), "pixel", frame, x, y)
+			}
+		}
+
+		frame++
+	}
+
+	require.True(t, frame == len(wantSeq), "frames", frame)
+}
+
+func TestAPNGDelay(t *testing.T) {
+	for _, tt := range []struct {
+		In       time.Duration
+		Num, Den uint16
+	}{
+		{100 * time.Millisecond, 100, 1000},
+		{65535 * time.Millisecond, 65535, 1000},
+		{70 * time.Second, 7000, 100},
+		{time.Hour, 0xffff, 100},
+	} {
+		num, den := apngDelay(tt.In)
+		require.True(t, num == tt.Num && den == tt.Den, "delay", tt.In, num, den)
+	}
+}
@@ -1,8 +1,9 @@
-// Package aseprite implements a decoder for Aseprite sprite files.
+// Package aseprite implements a decoder and encoder for Aseprite sprite files.
 //
 // Layers are flattened, blending modes are applied,
 // and frames are arranged on a single texture atlas.
 // Invisible and reference layers are ignored.
+// Layered documents are written with Encode.
 // Tilesets and external files are not supported.
 //
 // Aseprite file format spec: https://github.com/aseprite/aseprite/blob/main/docs/ase-file-specs.md
@@ -11,6 +12,7 @@ package aseprite
 import (
 	"image"
 	"image/color"
+	"image/draw"
 	"io"
 	"time"
 )
@@ -25,6 +27,102 @@ const (
 	PingPongReverse
 )
 
+var loopDirectionNames = [...]string{"forward", "reverse", "pingpong", "pingpong_reverse"}
+
+// String returns the name of the loop direction as used by Aseprite.
+func (d LoopDirection) String() string {
+	if int(d) < len(loopDirectionNames) {
+		return loopDirectionNames[d]
+	}
+	return "forward"
+}
+
+// BlendMode enumerates the layer blending modes.
+type BlendMode uint16
+
+const (
+	BlendNormal BlendMode = iota
+	BlendMultiply
+	BlendScreen
+	BlendOverlay
+	BlendDarken
+	BlendLighten
+	BlendColorDodge
+	BlendColorBurn
+	BlendHardLight
+	BlendSoftLight
+	BlendDifference
+	BlendExclusion
+	BlendHue
+	BlendSaturation
+	BlendColor
+	BlendLuminosity
+	BlendAddition
+	BlendSubtract
+	BlendDivide
+)
+
+var blendModeNames = [...]string{
+	"normal", "multiply", "screen", "overlay", "darken", "lighten",
+	"color_dodge", "color_burn", "hard_light", "soft_light", "difference",
+	"exclusion", "hue", "saturation", "color", "luminosity",
+	"addition", "subtract", "divide",
+}
+
+// String returns the name of the blend mode as used by Aseprite.
+func (m BlendMode) String() string {
+	if int(m) < len(blendModeNames) {
+		return blendModeNames[m]
+	}
+	return "normal"
+}
+
+// Layer describes a layer of the sprite.
+type Layer struct {
+	// Name is the name of the layer. Can be duplicate.
+	Name string
+
+	// Parent is the index of the group layer that contains the layer,
+	// or -1 if the layer is not in a group.
+	Parent int
+
+	// Group reports whether the layer is a group layer.
+	Group bool
+
+	// Visible reports whether the layer is visible.
+	Visible bool
+
+	// Locked reports whether the layer cannot be edited.
+	Locked bool
+
+	// LockMovement reports whether the cels of the layer cannot be moved.
+	LockMovement bool
+
+	// Background reports whether the layer is the background layer.
+	Background bool
+
+	// PreferLinked reports whether new cels of the layer are linked cels.
+	PreferLinked bool
+
+	// Collapsed reports whether the group layer is collapsed in the timeline.
+	Collapsed bool
+
+	// Reference reports whether the layer is a reference layer.
+	Reference bool
+
+	// Opacity is the opacity of the layer.
+	Opacity byte
+
+	// BlendMode is the blending mode of the layer.
+	BlendMode BlendMode
+
+	// Data is optional user data.
+	Data []byte
+
+	// Color is the optional layer color.
+	Color color.Color
+}
+
 // Tag is an animation tag.
 type Tag struct {
 	// Name is the name of the tag. Can be duplicate.
@@ -41,6 +139,9 @@ type Tag struct {
 
 	// LoopDirection is the looping direction of the animation.
 	LoopDirection LoopDirection
+
+	// Color is the tag color.
+	Color color.Color
 }
 
 // Frame represents a single frame in the sprite.
@@ -48,6 +149,18 @@ type Frame struct {
 	// Bounds is the image bounds of the frame in the sprite's atlas.
 	Bounds image.Rectangle
 
+	// Page is the index of the atlas page in the sprite's Pages
+	// that contains the frame image.
+	Page int
+
+	// Offset is the position of the frame image within the untrimmed frame.
+	// It is the zero point unless frames are trimmed.
+	Offset image.Point
+
+	// Size is the size of the untrimmed frame.
+	// It is equal to the size of Bounds unless frames are trimmed.
+	Size image.Point
+
 	// Duration is the time in seconds that the frame should be displayed for
 	// in a tag animation loop.
 	Duration time.Duration
@@ -58,7 +171,11 @@ type Frame struct {
 }
 
 // Slice represents a single slice.
+// A slice that changes over time is represented by one Slice per key.
 type Slice struct {
+	// Frame is the first frame that the slice key applies to.
+	Frame int
+
 	// Bounds is the bounds of the image in the texture atlas.
 	Bounds image.Rectangle
 
@@ -71,6 +188,19 @@ type Slice struct {
 	// Name is the name of the slice. Can be duplicate.
 	Name string
 
+	// ID identifies the slice that the key belongs to.
+	// Keys of the same slice have the same ID, which is the index
+	// of the slice in the file for decoded slices.
+	ID int
+
+	// HasCenter reports whether the slice is a 9-slice.
+	// Center is also written if it is not empty.
+	HasCenter bool
+
+	// HasPivot reports whether the slice has a pivot point.
+	// Pivot is also written if it is not the zero point.
+	HasPivot bool
+
 	// Data is optional user data.
 	Data []byte
 
@@ -82,8 +212,15 @@ type Slice struct {
 type Aseprite struct {
 	// Image contains all frame images in a single image.
 	// Frame bounds specify where the frame images are located.
+	// Image is an *image.Paletted for indexed sprites,
+	// a *GrayAlpha for grayscale sprites and an *image.RGBA otherwise.
 	image.Image
 
+	// Pages lists all atlas pages. The first page is Image.
+	// There is more than one page only if the frames do not fit
+	// on a single page of Options.MaxSize.
+	Pages []image.Image
+
 	// Frames lists all frames that make up the sprite.
 	Frames []Frame
 
@@ -95,31 +232,93 @@ type Aseprite struct {
 
 	// LayerData lists the user data of all visible layers.
 	LayerData [][]byte
+
+	// Layers lists all layers in order from bottom to top.
+	Layers []Layer
+
+	// ChunkValues lists the values returned by Options.ChunkHandlers in file order.
+	ChunkValues []ChunkValue
 }
 
-func (spr *Aseprite) readFrom(r io.Reader) error {
+func (spr *Aseprite) readFrom(r io.Reader, opts *Options) error {
 	var f file
 
 	if _, err := f.ReadFrom(r); err != nil {
 		return err
 	}
 
-	f.initPalette()
+	chunkValues, err := f.handleChunks(opts)
+	if err != nil {
+		return err
+	}
 
-	if err := f.initLayers(); err != nil {
+	frames, err := f.decode(opts)
+	if err != nil {
 		return err
 	}
 
-	if err := f.initCels(); err != nil {
+	srcs := f.frameSources(opts, frames)
+
+	pages, framesr, pageOf, err := f.buildAtlas(opts, frames, srcs)
+	if err != nil {
 		return err
 	}
 
-	var framesr []image.Rectangle
-	spr.Image, framesr = f.buildAtlas()
+	spr.Pages = pages
+
+	spr.Image = spr.Pages[0]
 	userdata := f.buildUserData()
-	spr.Frames, userdata = f.buildFrames(framesr, userdata)
+	spr.Frames, userdata = f.buildFrames(framesr, srcs, pageOf, userdata)
 	spr.LayerData = f.buildLayerData(userdata)
+	spr.Layers = f.buildLayers()
 	spr.Tags = f.buildTags()
 	spr.Slices = f.buildSlices()
+	spr.ChunkValues = chunkValues
 	return nil
 }
+
+// FrameImage returns the image of frame i in the atlas without copying it.
+// The image has the same concrete type and coordinates as the atlas page,
+// so its bounds are Frames[i].Bounds.
+// The image of a trimmed frame only covers the trimmed area.
+// It returns nil if i is not a frame of the sprite.
+func (spr *Aseprite) FrameImage(i int) image.Image {
+	if i < 0 || i >= len(spr.Frames) || spr.Frames[i].Page >= len(spr.Pages) {
+		return nil
+	}
+
+	fr := spr.Frames[i]
+	page := spr.Pages[fr.Page]
+
+	if p, ok := page.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return p.SubImage(fr.Bounds)
+	}
+
+	// atlas pages that cannot be sliced are copied
+	img := image.NewNRGBA(fr.Bounds)
+	draw.Draw(img, fr.Bounds, page, fr.Bounds.Min, draw.Src)
+	return img
+}
+
+// TagImages returns the frame images of the first tag with the given name
+// from its first to its last frame, as returned by FrameImage.
+// It returns nil if there is no tag with the name
+// or the frames of the tag are not in the sprite.
+func (spr *Aseprite) TagImages(name string) []image.Image {
+	t, ok := spr.FindTag(name)
+	if !ok {
+		return nil
+	}
+
+	if _, err := spriteTag(spr, &t); err != nil {
+		return nil
+	}
+
+	images := make([]image.Image, 0, int(t.Hi)-int(t.Lo)+1)
+	for i := int(t.Lo); i <= int(t.Hi); i++ {
+		images = append(images, spr.FrameImage(i))
+	}
+	return images
+}
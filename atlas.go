@@ -0,0 +1,409 @@
+package aseprite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"image"
+	"math"
+)
+
+// frameSources returns the bounds of the frame images within their frames.
+// The bounds are the entire frame unless frames are trimmed,
+// in which case frames must be the composited frames.
+func (f *file) frameSources(opts *Options, frames []image.Image) []image.Rectangle {
+	srcs := make([]image.Rectangle, len(f.frames))
+	for i := range srcs {
+		if opts != nil && opts.Trim {
+			srcs[i] = opaqueBounds(frames[i])
+		} else {
+			srcs[i] = image.Rect(0, 0, f.framew, f.frameh)
+		}
+	}
+	return srcs
+}
+
+// opaqueBounds returns the smallest rectangle that contains
+// all pixels of img that are not fully transparent.
+func opaqueBounds(img image.Image) image.Rectangle {
+	opaque := func(x, y int) bool {
+		_, _, _, a := img.At(x, y).RGBA()
+		return a != 0
+	}
+	if img, ok := img.(*image.NRGBA); ok {
+		opaque = func(x, y int) bool {
+			return img.Pix[img.PixOffset(x, y)+3] != 0
+		}
+	}
+
+	b := img.Bounds()
+	r := image.Rectangle{Min: b.Max, Max: b.Min}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if opaque(x, y) {
+				if x < r.Min.X {
+					r.Min.X = x
+				}
+				if x >= r.Max.X {
+					r.Max.X = x + 1
+				}
+				if y < r.Min.Y {
+					r.Min.Y = y
+				}
+				r.Max.Y = y + 1
+			}
+		}
+	}
+
+	if r.Empty() {
+		return image.Rectangle{}
+	}
+	return r
+}
+
+// frameSlots assigns every frame to a slot on the atlas.
+// Frames share a slot if they are deduplicated and their images are identical.
+// Slots are numbered in order of the first frame that occupies them.
+// The frame images must be of the same type and,
+// if they are paletted, have the same palette.
+func frameSlots(opts *Options, frames []image.Image, srcs []image.Rectangle) []int {
+	slots := make([]int, len(srcs))
+	if opts == nil || !opts.Dedupe {
+		for i := range slots {
+			slots[i] = i
+		}
+		return slots
+	}
+
+	// maps hashes to the first frames with that hash
+	seen := make(map[uint64][]int)
+	nslots := 0
+
+next:
+	for i := range slots {
+		h := hashFrame(frames[i], srcs[i])
+		for _, j := range seen[h] {
+			if equalFrames(frames[i], srcs[i], frames[j], srcs[j]) {
+				slots[i] = slots[j]
+				continue next
+			}
+		}
+		seen[h] = append(seen[h], i)
+		slots[i] = nslots
+		nslots++
+	}
+
+	return slots
+}
+
+// hashFrame hashes the pixels of img within r.
+func hashFrame(img image.Image, r image.Rectangle) uint64 {
+	h := fnv.New64a()
+	var size [16]byte
+	binary.LittleEndian.PutUint64(size[0:], uint64(r.Dx()))
+	binary.LittleEndian.PutUint64(size[8:], uint64(r.Dy()))
+	_, _ = h.Write(size[:])
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		_, _ = h.Write(pixRow(img, r.Min.X, r.Max.X, y))
+	}
+	return h.Sum64()
+}
+
+// equalFrames reports whether the pixels of a within ar
+// are identical to the pixels of b within br.
+func equalFrames(a image.Image, ar image.Rectangle, b image.Image, br image.Rectangle) bool {
+	if ar.Size() != br.Size() {
+		return false
+	}
+	for y := 0; y < ar.Dy(); y++ {
+		rowa := pixRow(a, ar.Min.X, ar.Max.X, ar.Min.Y+y)
+		rowb := pixRow(b, br.Min.X, br.Max.X, br.Min.Y+y)
+		if !bytes.Equal(rowa, rowb) {
+			return false
+		}
+	}
+	return true
+}
+
+// pixRow returns the pixels of img in row y from x0 to x1 as they are stored in memory.
+// img must be one of the image types that frame images are stored in.
+func pixRow(img image.Image, x0, x1, y int) []byte {
+	switch img := img.(type) {
+	case *image.NRGBA:
+		i := img.PixOffset(x0, y)
+		return img.Pix[i : i+4*(x1-x0)]
+	case *image.RGBA:
+		i := img.PixOffset(x0, y)
+		return img.Pix[i : i+4*(x1-x0)]
+	case *GrayAlpha:
+		i := img.PixOffset(x0, y)
+		return img.Pix[i : i+2*(x1-x0)]
+	case *image.Paletted:
+		i := img.PixOffset(x0, y)
+		return img.Pix[i : i+(x1-x0)]
+	}
+	panic("aseprite: unsupported frame image type")
+}
+
+// countSlots returns the number of slots assigned by frameSlots.
+func countSlots(slots []int) (n int) {
+	for _, s := range slots {
+		if s >= n {
+			n = s + 1
+		}
+	}
+	return n
+}
+
+// atlasLayout computes the bounds of the atlas pages and the bounds and page
+// of every frame image, given the bounds of the frame images within their frames
+// and the slots of the frames.
+func (f *file) atlasLayout(opts *Options, srcs []image.Rectangle, slots []int) (pages, framesr []image.Rectangle, pageOf []int, err error) {
+	return layoutAtlas(opts, srcs, slots, image.Pt(f.framew, f.frameh), f.buildTags())
+}
+
+// layoutAtlas computes the bounds of the atlas pages and the bounds and page
+// of every frame image. Grid layouts use frameSize as the nominal size of
+// the frames and tags to arrange tag rows.
+func layoutAtlas(opts *Options, srcs []image.Rectangle, slots []int, frameSize image.Point, tags []Tag) (pages, framesr []image.Rectangle, pageOf []int, err error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	o.BorderPadding, o.Spacing, o.Extrude = nonNegative(o.BorderPadding), nonNegative(o.Spacing), nonNegative(o.Extrude)
+
+	// Every slot occupies a cell that includes the extruded pixels and
+	// the spacing to the next cell. The last spacing is replaced by the border.
+	sizes := make([]image.Point, countSlots(slots))
+	for i, sr := range srcs {
+		if sr.Empty() {
+			continue
+		}
+		sizes[slots[i]] = sr.Size().Add(image.Pt(2*o.Extrude+o.Spacing, 2*o.Extrude+o.Spacing))
+	}
+
+	var cellsr []image.Rectangle
+	var cellPage []int
+
+	if o.Layout == LayoutPacked {
+		maxSize := o.MaxSize
+		if maxSize.X > 0 {
+			maxSize.X = pageSpace(maxSize.X, o)
+		}
+		if maxSize.Y > 0 {
+			maxSize.Y = pageSpace(maxSize.Y, o)
+		}
+		if pages, cellsr, cellPage, err = packRects(sizes, maxSize); err != nil {
+			return nil, nil, nil, err
+		}
+	} else {
+		g := layoutFrames(opts, slots, frameSize.X, frameSize.Y, tags)
+		var atlasr image.Rectangle
+		atlasr, cellsr = placeFrames(g, sizes)
+		pages, cellPage = []image.Rectangle{atlasr}, make([]int, len(cellsr))
+	}
+
+	for i, r := range pages {
+		size := r.Size().Add(image.Pt(2*o.BorderPadding-o.Spacing, 2*o.BorderPadding-o.Spacing))
+		if r.Empty() {
+			size = image.Pt(2*o.BorderPadding, 2*o.BorderPadding)
+		}
+		if o.PowerOfTwo {
+			size = image.Pt(ceilPowerOfTwo(size.X), ceilPowerOfTwo(size.Y))
+		}
+		pages[i] = image.Rectangle{Max: size}
+	}
+
+	framesr, pageOf = make([]image.Rectangle, len(srcs)), make([]int, len(srcs))
+	offset := image.Pt(o.BorderPadding+o.Extrude, o.BorderPadding+o.Extrude)
+	for i, sr := range srcs {
+		min := cellsr[slots[i]].Min.Add(offset)
+		framesr[i] = image.Rectangle{Min: min, Max: min.Add(sr.Size())}
+		pageOf[i] = cellPage[slots[i]]
+	}
+
+	return pages, framesr, pageOf, nil
+}
+
+// pageSpace returns the space available to frame cells on a page
+// that is at most n pixels wide or high.
+func pageSpace(n int, o Options) int {
+	if o.PowerOfTwo {
+		n = floorPowerOfTwo(n)
+	}
+	if n -= 2*o.BorderPadding - o.Spacing; n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// atlasGrid assigns each slot to a cell in a grid of cols x rows cells.
+type atlasGrid struct {
+	cols, rows int
+	cells      []image.Point
+}
+
+// layoutFrames arranges the slots of frames of framew x frameh pixels
+// in a grid according to the layout option.
+func layoutFrames(opts *Options, slots []int, framew, frameh int, tags []Tag) (g atlasGrid) {
+	nframes := countSlots(slots)
+	layout, columns := LayoutPowerOfTwo, 0
+	if opts != nil {
+		layout, columns = opts.Layout, opts.Columns
+	}
+
+	switch layout {
+	case LayoutHorizontal:
+		g.cols, g.rows = nframes, 1
+	case LayoutVertical:
+		g.cols, g.rows = 1, nframes
+	case LayoutColumns:
+		if columns < 1 {
+			columns = 1
+		}
+		g.cols, g.rows = columns, (nframes+columns-1)/columns
+	case LayoutSquare:
+		g.cols, g.rows = squareGrid(nframes, framew, frameh)
+	case LayoutTagRows:
+		return tagRowsGrid(slots, tags)
+	default:
+		g.cols, g.rows = factorPowerOfTwo(nframes)
+		if framew > frameh {
+			g.cols, g.rows = g.rows, g.cols
+		}
+	}
+
+	g.cells = make([]image.Point, nframes)
+	for i := range g.cells {
+		g.cells[i] = image.Pt(i%g.cols, i/g.cols)
+	}
+
+	return g
+}
+
+// squareGrid returns the grid dimensions that make the atlas as square as possible.
+func squareGrid(nframes, framew, frameh int) (cols, rows int) {
+	best := -1
+	for c := 1; c <= nframes; c++ {
+		r := (nframes + c - 1) / c
+		w, h := c*framew, r*frameh
+		side := w
+		if h > side {
+			side = h
+		}
+		if best < 0 || side < best || (side == best && c*r < cols*rows) {
+			best, cols, rows = side, c, r
+		}
+	}
+	return cols, rows
+}
+
+// tagRowsGrid places the slots of the frames of each tag on a separate row.
+// Slots are placed only once, in the row of the first tag that contains them,
+// and slots that are not part of any tag are placed on the last row.
+func tagRowsGrid(slots []int, tags []Tag) (g atlasGrid) {
+	nslots := countSlots(slots)
+	g.cells = make([]image.Point, nslots)
+	placed := make([]bool, nslots)
+
+	addRow := func(lo, hi int) {
+		col := 0
+		for i := lo; i <= hi && i < len(slots); i++ {
+			if s := slots[i]; !placed[s] {
+				placed[s] = true
+				g.cells[s] = image.Pt(col, g.rows)
+				col++
+			}
+		}
+		if col > 0 {
+			g.rows++
+			if col > g.cols {
+				g.cols = col
+			}
+		}
+	}
+
+	for _, t := range tags {
+		addRow(int(t.Lo), int(t.Hi))
+	}
+	addRow(0, len(slots)-1)
+
+	return g
+}
+
+// placeFrames computes the bounds of the atlas and of every frame in it,
+// given the grid and the size of every frame. Each column is as wide as
+// its widest frame and each row is as high as its highest frame.
+// Empty columns and rows take the size of the largest frame.
+func placeFrames(g atlasGrid, sizes []image.Point) (atlasr image.Rectangle, framesr []image.Rectangle) {
+	var maxsize image.Point
+	for _, sz := range sizes {
+		if sz.X > maxsize.X {
+			maxsize.X = sz.X
+		}
+		if sz.Y > maxsize.Y {
+			maxsize.Y = sz.Y
+		}
+	}
+
+	colw := make([]int, g.cols)
+	rowh := make([]int, g.rows)
+	colused := make([]bool, g.cols)
+	rowused := make([]bool, g.rows)
+
+	for i, c := range g.cells {
+		colused[c.X], rowused[c.Y] = true, true
+		if sizes[i].X > colw[c.X] {
+			colw[c.X] = sizes[i].X
+		}
+		if sizes[i].Y > rowh[c.Y] {
+			rowh[c.Y] = sizes[i].Y
+		}
+	}
+
+	// convert sizes to offsets
+	colx := make([]int, g.cols+1)
+	for i, w := range colw {
+		if !colused[i] {
+			w = maxsize.X
+		}
+		colx[i+1] = colx[i] + w
+	}
+
+	rowy := make([]int, g.rows+1)
+	for i, h := range rowh {
+		if !rowused[i] {
+			h = maxsize.Y
+		}
+		rowy[i+1] = rowy[i] + h
+	}
+
+	atlasr = image.Rect(0, 0, colx[g.cols], rowy[g.rows])
+
+	framesr = make([]image.Rectangle, len(g.cells))
+	for i, c := range g.cells {
+		min := image.Pt(colx[c.X], rowy[c.Y])
+		framesr[i] = image.Rectangle{Min: min, Max: min.Add(sizes[i])}
+	}
+
+	return
+}
+
+func nonNegative(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// factorPowerOfTwo computes n=a*b, where a, b are powers of two and a >= b.
+// It returns 1, 1 if n is less than two.
+func factorPowerOfTwo(n int) (a, b int) {
+	if n < 2 {
+		return 1, 1
+	}
+	x := int(math.Ceil(math.Log2(float64(n))))
+	a = 1 << (x - x/2)
+	b = 1 << (x / 2)
+	return
+}
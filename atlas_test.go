@@ -0,0 +1,180 @@
+package aseprite
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func TestLayout(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/slime_paletted.aseprite")
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		Name    string
+		Options Options
+		Size    image.Point
+		Frame4  image.Point
+	}{
+		{"power_of_two", Options{}, image.Pt(128, 256), image.Pt(0, 64)},
+		{"horizontal", Options{Layout: LayoutHorizontal}, image.Pt(320, 64), image.Pt(128, 0)},
+		{"vertical", Options{Layout: LayoutVertical}, image.Pt(32, 640), image.Pt(0, 256)},
+		{"columns", Options{Layout: LayoutColumns, Columns: 3}, image.Pt(96, 256), image.Pt(32, 64)},
+		{"tag_rows", Options{Layout: LayoutTagRows}, image.Pt(160, 192), image.Pt(0, 128)},
+		{"square", Options{Layout: LayoutSquare}, image.Pt(160, 128), image.Pt(128, 0)},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			conf, err := DecodeConfigWithOptions(bytes.NewReader(raw), &tt.Options)
+			require.NoError(t, err)
+			require.True(t, conf.Width == tt.Size.X && conf.Height == tt.Size.Y, "config size", conf.Width, conf.Height)
+
+			spr, err := ReadWithOptions(bytes.NewReader(raw), &tt.Options)
+			require.NoError(t, err)
+			require.True(t, spr.Bounds().Size() == tt.Size, "atlas size", spr.Bounds())
+			require.True(t, spr.Frames[4].Bounds.Min == tt.Frame4, "frame 4", spr.Frames[4].Bounds)
+
+			for i, fr := range spr.Frames {
+				require.True(t, fr.Bounds.Size() == image.Pt(32, 64), "frame size", i)
+				require.True(t, fr.Bounds.In(spr.Bounds()), "frame outside atlas", i)
+				for j := 0; j < i; j++ {
+					require.True(t, !fr.Bounds.Overlaps(spr.Frames[j].Bounds), "frames overlap", i, j)
+				}
+			}
+		})
+	}
+}
+
+func TestTrim(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/slime_paletted.aseprite")
+	require.NoError(t, err)
+
+	full, err := Read(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	opts := Options{Layout: LayoutHorizontal, Trim: true}
+	spr, err := ReadWithOptions(bytes.NewReader(raw), &opts)
+	require.NoError(t, err)
+
+	conf, err := DecodeConfigWithOptions(bytes.NewReader(raw), &opts)
+	require.NoError(t, err)
+	require.True(t, conf.Width == spr.Bounds().Dx() && conf.Height == spr.Bounds().Dy(), "config size")
+	require.True(t, spr.Bounds().Dx() < 320 && spr.Bounds().Dy() < 64, "atlas not trimmed", spr.Bounds())
+
+	for i, fr := range spr.Frames {
+		require.True(t, fr.Size == image.Pt(32, 64), "size", i)
+		require.True(t, fr.Bounds.Size() != fr.Size, "frame not trimmed", i)
+		require.True(t, fr.Bounds.Add(fr.Offset.Sub(fr.Bounds.Min)).In(image.Rectangle{Max: fr.Size}), "offset", i)
+
+		// every pixel of the untrimmed frame is either in the trimmed frame or transparent
+		fullr := full.Frames[i].Bounds
+		for y := 0; y < fr.Size.Y; y++ {
+			for x := 0; x < fr.Size.X; x++ {
+				want := full.At(fullr.Min.X+x, fullr.Min.Y+y)
+				p := image.Pt(x, y).Sub(fr.Offset).Add(fr.Bounds.Min)
+				if p.In(fr.Bounds) {
+					require.True(t, spr.At(p.X, p.Y) == want, "pixel", i, x, y)
+				} else {
+					_, _, _, a := want.RGBA()
+					require.True(t, a == 0, "trimmed opaque pixel", i, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestPadding(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/slime_paletted.aseprite")
+	require.NoError(t, err)
+
+	opts := Options{Layout: LayoutHorizontal, BorderPadding: 2, Spacing: 3, Extrude: 1}
+	spr, err := ReadWithOptions(bytes.NewReader(raw), &opts)
+	require.NoError(t, err)
+	require.True(t, spr.Bounds().Size() == image.Pt(4+10*34+9*3, 4+66), "atlas size", spr.Bounds())
+	require.True(t, spr.Frames[4].Bounds.Min == image.Pt(3+4*37, 3), "frame 4", spr.Frames[4].Bounds)
+
+	conf, err := DecodeConfigWithOptions(bytes.NewReader(raw), &opts)
+	require.NoError(t, err)
+	require.True(t, conf.Width == spr.Bounds().Dx() && conf.Height == spr.Bounds().Dy(), "config size")
+
+	transparent := func(x, y int) bool {
+		_, _, _, a := spr.At(x, y).RGBA()
+		return a == 0
+	}
+
+	for y := 0; y < spr.Bounds().Dy(); y++ {
+		require.True(t, transparent(0, y) && transparent(1, y), "left border", y)
+	}
+
+	for i, fr := range spr.Frames {
+		for y := fr.Bounds.Min.Y; y < fr.Bounds.Max.Y && i+1 < len(spr.Frames); y++ {
+			require.True(t, transparent(fr.Bounds.Max.X+1, y), "spacing", i, y)
+		}
+	}
+
+	opts.PowerOfTwo = true
+	spr, err = ReadWithOptions(bytes.NewReader(raw), &opts)
+	require.NoError(t, err)
+	require.True(t, spr.Bounds().Size() == image.Pt(512, 128), "power of two size", spr.Bounds())
+}
+
+func TestExtrude(t *testing.T) {
+	raw := makeTestFile(3, 8, 6, gradientLayers(0))
+
+	for _, layout := range []Layout{LayoutHorizontal, LayoutPacked} {
+		spr, err := ReadWithOptions(bytes.NewReader(raw), &Options{Layout: layout, Spacing: 1, Extrude: 2})
+		require.NoError(t, err)
+
+		for i, fr := range spr.Frames {
+			r := fr.Bounds
+			clamp := func(v, lo, hi int) int {
+				if v < lo {
+					return lo
+				} else if v >= hi {
+					return hi - 1
+				}
+				return v
+			}
+			for y := r.Min.Y - 2; y < r.Max.Y+2; y++ {
+				for x := r.Min.X - 2; x < r.Max.X+2; x++ {
+					want := spr.At(clamp(x, r.Min.X, r.Max.X), clamp(y, r.Min.Y, r.Max.Y))
+					require.True(t, spr.At(x, y) == want, "pixel", layout, i, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	// frames 0 and 1, and frames 2 and 3 are identical
+	raw := makeTestFile(5, 8, 6, []testLayer{{
+		Opacity: 255,
+		Pixel: func(frame, x, y int) color.NRGBA {
+			return color.NRGBA{byte(x), byte(y), byte(frame / 2), 255}
+		},
+	}})
+
+	for _, layout := range []Layout{LayoutHorizontal, LayoutTagRows, LayoutPacked} {
+		opts := Options{Layout: layout, Dedupe: true}
+		spr, err := ReadWithOptions(bytes.NewReader(raw), &opts)
+		require.NoError(t, err)
+
+		conf, err := DecodeConfigWithOptions(bytes.NewReader(raw), &opts)
+		require.NoError(t, err)
+		require.True(t, conf.Width == spr.Bounds().Dx() && conf.Height == spr.Bounds().Dy(), "config size", layout)
+		require.True(t, spr.Bounds().Dx()*spr.Bounds().Dy() == 3*8*6, "atlas size", layout, spr.Bounds())
+
+		fr := spr.Frames
+		require.True(t, fr[0].Bounds == fr[1].Bounds && fr[2].Bounds == fr[3].Bounds, "shared bounds", layout)
+		require.True(t, fr[1].Bounds != fr[2].Bounds && fr[3].Bounds != fr[4].Bounds, "distinct bounds", layout)
+
+		for i := range fr {
+			r := fr[i].Bounds
+			want := color.RGBA{3, 2, byte(i / 2), 255}
+			require.True(t, spr.At(r.Min.X+3, r.Min.Y+2) == want, "pixel", layout, i)
+		}
+	}
+}
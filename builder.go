@@ -0,0 +1,191 @@
+package aseprite
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"time"
+)
+
+// defaultDuration is the duration of new frames in Aseprite.
+const defaultDuration = 100 * time.Millisecond
+
+// NewDocument returns a document with a single layer that shows frames[i]
+// in frame i for durations[i], so that rendered or imported animations
+// can be written as Aseprite files.
+// A single duration applies to all frames, and no durations
+// mean that every frame lasts 100 milliseconds.
+//
+// The canvas covers the bounds of all frames and
+// the frames are positioned by their bounds relative to the canvas.
+// The document is indexed if all frames are paletted images with the same palette
+// and has RGBA colors otherwise. A transparent color is added to the palette
+// if it has none.
+// The images are copied and cropped to their opaque pixels.
+// Frames without opaque pixels have no cel.
+func NewDocument(frames []image.Image, durations []time.Duration, tags []Tag) (*Document, error) {
+	if len(frames) == 0 {
+		return nil, errors.New("aseprite: no frames")
+	} else if n := len(durations); n > 1 && n != len(frames) {
+		return nil, errors.New("aseprite: number of durations does not match the number of frames")
+	}
+
+	var canvas image.Rectangle
+	for _, img := range frames {
+		canvas = canvas.Union(img.Bounds())
+	}
+
+	if canvas.Empty() {
+		return nil, errors.New("aseprite: frames are empty")
+	}
+
+	doc := Document{
+		Width:  canvas.Dx(),
+		Height: canvas.Dy(),
+		Layers: []Layer{{Name: "Layer 1", Parent: -1, Visible: true, Opacity: 255}},
+		Frames: make([]DocumentFrame, len(frames)),
+		Tags:   append([]Tag(nil), tags...),
+	}
+
+	if p, ok := sharedPalette(frames); ok {
+		if p, transparent, ok := withTransparent(p); ok {
+			doc.ColorMode, doc.Palette, doc.Transparent = ColorIndexed, p, transparent
+		}
+	}
+
+	for i, img := range frames {
+		doc.Frames[i].Duration = defaultDuration
+		if len(durations) == 1 {
+			doc.Frames[i].Duration = durations[0]
+		} else if len(durations) > 1 {
+			doc.Frames[i].Duration = durations[i]
+		}
+
+		if r := opaqueBounds(img); !r.Empty() {
+			doc.Frames[i].Cels = []Cel{{
+				Image:   doc.copyImage(img, r, canvas.Min),
+				Opacity: 255,
+			}}
+		}
+	}
+
+	return &doc, nil
+}
+
+// DocumentFromGIF returns a document with a single layer that shows
+// the frames of g as they are displayed, applying the disposal methods.
+// Delays of zero become 100 milliseconds and the loop count is ignored.
+// The document is indexed if all frames use the same palette.
+func DocumentFromGIF(g *gif.GIF) (*Document, error) {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	for _, img := range g.Image {
+		bounds = bounds.Union(img.Bounds())
+	}
+	bounds.Min = image.Point{}
+
+	frames := make([]image.Image, len(g.Image))
+	durations := make([]time.Duration, len(g.Image))
+	canvas := image.NewNRGBA(bounds)
+
+	for i, img := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+		frames[i] = cloneNRGBA(canvas)
+
+		durations[i] = defaultDuration
+		if i < len(g.Delay) && g.Delay[i] > 0 {
+			durations[i] = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	// convert the frames back to the shared palette
+	palettes := make([]image.Image, len(g.Image))
+	for i, img := range g.Image {
+		palettes[i] = img
+	}
+	if p, ok := sharedPalette(palettes); ok {
+		if p, transparent, ok := withTransparent(p); ok {
+			for i, img := range frames {
+				frames[i] = palettedFrame(img.(*image.NRGBA), p, transparent)
+			}
+		}
+	}
+
+	return NewDocument(frames, durations, nil)
+}
+
+// sharedPalette returns the palette of the frames
+// if they are all paletted images with the same palette.
+func sharedPalette(frames []image.Image) (color.Palette, bool) {
+	var p color.Palette
+	for i, img := range frames {
+		img, ok := img.(*image.Paletted)
+		if !ok || (i > 0 && !equalPalettes(p, img.Palette)) {
+			return nil, false
+		}
+		p = img.Palette
+	}
+	return p, len(p) > 0
+}
+
+// withTransparent returns p and the index of its first transparent color.
+// If p has no transparent color, it returns a copy of p with one added.
+// It reports false if p is full.
+func withTransparent(p color.Palette) (color.Palette, uint8, bool) {
+	for i, c := range p {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return p, uint8(i), true
+		}
+	}
+
+	if len(p) >= 256 {
+		return nil, 0, false
+	}
+
+	return append(append(color.Palette(nil), p...), color.Transparent), uint8(len(p)), true
+}
+
+// copyImage copies the part r of img in the color mode of the document
+// and moves it by -offset.
+func (doc *Document) copyImage(img image.Image, r image.Rectangle, offset image.Point) image.Image {
+	dr := r.Sub(offset)
+
+	if doc.ColorMode == ColorIndexed {
+		// the palette of the document only adds colors to the palette of img
+		src := img.(*image.Paletted)
+		dst := image.NewPaletted(dr, doc.Palette)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			i, j := src.PixOffset(r.Min.X, y), dst.PixOffset(dr.Min.X, y-offset.Y)
+			copy(dst.Pix[j:j+r.Dx()], src.Pix[i:i+r.Dx()])
+		}
+		return dst
+	}
+
+	dst := image.NewNRGBA(dr)
+	draw.Draw(dst, dr, img, r.Min, draw.Src)
+	return dst
+}
+
+func cloneNRGBA(img *image.NRGBA) *image.NRGBA {
+	dst := *img
+	dst.Pix = append([]uint8(nil), img.Pix...)
+	return &dst
+}
@@ -0,0 +1,146 @@
+package aseprite
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+	"time"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func TestNewDocumentRGBA(t *testing.T) {
+	a := image.NewRGBA(image.Rect(2, 1, 6, 5))
+	a.Set(3, 2, color.RGBA{255, 0, 0, 255})
+	a.Set(4, 4, color.RGBA{0, 128, 0, 128})
+
+	b := image.NewNRGBA(image.Rect(4, 3, 8, 7))
+	b.SetNRGBA(7, 6, color.NRGBA{0, 0, 255, 255})
+
+	empty := image.NewNRGBA(image.Rect(2, 1, 3, 2))
+
+	tags := []Tag{{Name: "all", Hi: 2}}
+	doc, err := NewDocument([]image.Image{a, b, empty}, []time.Duration{50 * time.Millisecond}, tags)
+	require.NoError(t, err)
+
+	require.True(t, doc.ColorMode == ColorRGBA, "color mode")
+	require.True(t, doc.Width == 6 && doc.Height == 6, "canvas", doc.Width, doc.Height)
+	require.True(t, len(doc.Frames[2].Cels) == 0, "empty frame")
+
+	// cels are cropped and positioned relative to the canvas
+	require.True(t, doc.Frames[0].Cels[0].Image.Bounds() == image.Rect(1, 1, 3, 4), "cel bounds", doc.Frames[0].Cels[0].Image.Bounds())
+	require.True(t, doc.Frames[1].Cels[0].Image.Bounds() == image.Rect(5, 5, 6, 6), "cel bounds", doc.Frames[1].Cels[0].Image.Bounds())
+
+	spr, _ := encodeAndRead(t, doc)
+	require.True(t, len(spr.Tags) == 1 && spr.Tags[0].Name == "all", "tags")
+	for i, img := range []image.Image{a, b, empty} {
+		require.True(t, spr.Frames[i].Duration == 50*time.Millisecond, "duration", i)
+		for y := 0; y < 6; y++ {
+			for x := 0; x < 6; x++ {
+				want := color.NRGBAModel.Convert(img.At(x+2, y+1))
+				require.True(t, spriteFrame(spr, i).At(x, y) == want, "pixel", i, x, y)
+			}
+		}
+	}
+}
+
+func TestNewDocumentPaletted(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+
+	frames := make([]image.Image, 3)
+	for i := range frames {
+		img := image.NewPaletted(image.Rect(0, 0, 3, 3), palette)
+		img.Pix[i*4] = 1
+		frames[i] = img
+	}
+
+	durations := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}
+	doc, err := NewDocument(frames, durations, nil)
+	require.NoError(t, err)
+
+	// the palette has no transparent color, so one is added
+	require.True(t, doc.ColorMode == ColorIndexed && len(doc.Palette) == 3 && doc.Transparent == 2, "palette")
+
+	spr, _ := encodeAndRead(t, doc)
+	_, ok := spr.Image.(*image.Paletted)
+	require.True(t, ok, "paletted atlas")
+	for i, img := range frames {
+		require.True(t, spr.Frames[i].Duration == durations[i], "duration", i)
+		requireFrame(t, spr, i, img)
+	}
+
+	// different palettes are converted to RGBA
+	frames[1] = image.NewPaletted(image.Rect(0, 0, 3, 3), color.Palette{color.White})
+	doc, err = NewDocument(frames, nil, nil)
+	require.NoError(t, err)
+	require.True(t, doc.ColorMode == ColorRGBA && doc.Frames[0].Duration == 100*time.Millisecond, "rgba")
+
+	_, err = NewDocument(nil, nil, nil)
+	require.True(t, err != nil, "no frames")
+	_, err = NewDocument(frames, durations[:2], nil)
+	require.True(t, err != nil, "durations")
+}
+
+func TestDocumentFromGIF(t *testing.T) {
+	palette := color.Palette{color.Transparent, color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 255, 0, 255}}
+
+	full := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+	for i := range full.Pix {
+		full.Pix[i] = 1
+	}
+
+	// the second frame only updates a part of the canvas and is then cleared
+	part := image.NewPaletted(image.Rect(1, 1, 3, 3), palette)
+	part.Pix[0], part.Pix[3] = 2, 2
+
+	dot := image.NewPaletted(image.Rect(0, 0, 1, 1), palette)
+	dot.Pix[0] = 2
+
+	g := gif.GIF{
+		Image:    []*image.Paletted{full, part, dot},
+		Delay:    []int{5, 0, 10},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		Config:   image.Config{Width: 4, Height: 4},
+	}
+
+	// encode and decode to use the palettes that image/gif produces
+	var b bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&b, &g))
+	decoded, err := gif.DecodeAll(&b)
+	require.NoError(t, err)
+
+	doc, err := DocumentFromGIF(decoded)
+	require.NoError(t, err)
+	require.True(t, doc.ColorMode == ColorIndexed, "color mode")
+
+	spr, _ := encodeAndRead(t, doc)
+
+	red, green := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 255, 0, 255}
+	want := [3][4]string{
+		{"rrrr", "rrrr", "rrrr", "rrrr"},
+		{"rrrr", "rgrr", "rrgr", "rrrr"},
+		{"grrr", "r  r", "r  r", "rrrr"},
+	}
+	for i := range want {
+		img := spriteFrame(spr, i)
+		for y, row := range want[i] {
+			for x, c := range row {
+				px := img.NRGBAAt(x, y)
+				switch c {
+				case 'r':
+					require.True(t, px == red, "red", i, x, y)
+				case 'g':
+					require.True(t, px == green, "green", i, x, y)
+				default:
+					require.True(t, px.A == 0, "transparent", i, x, y)
+				}
+			}
+		}
+	}
+
+	for i, d := range []time.Duration{50, 100, 100} {
+		require.True(t, spr.Frames[i].Duration == d*time.Millisecond, "duration", i, spr.Frames[i].Duration)
+	}
+}
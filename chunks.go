@@ -0,0 +1,169 @@
+package aseprite
+
+import (
+	"io"
+	"strconv"
+)
+
+// ChunkType enumerates the chunk types of the Aseprite file format.
+type ChunkType uint16
+
+const (
+	ChunkOldPalette    ChunkType = 0x0004
+	ChunkOldPalette64  ChunkType = 0x0011
+	ChunkLayer         ChunkType = 0x2004
+	ChunkCel           ChunkType = 0x2005
+	ChunkCelExtra      ChunkType = 0x2006
+	ChunkColorProfile  ChunkType = 0x2007
+	ChunkExternalFiles ChunkType = 0x2008
+	ChunkMask          ChunkType = 0x2016
+	ChunkPath          ChunkType = 0x2017
+	ChunkTags          ChunkType = 0x2018
+	ChunkPalette       ChunkType = 0x2019
+	ChunkUserData      ChunkType = 0x2020
+	ChunkSlice         ChunkType = 0x2022
+	ChunkTileset       ChunkType = 0x2023
+)
+
+var chunkTypeNames = map[ChunkType]string{
+	ChunkOldPalette:    "old_palette",
+	ChunkOldPalette64:  "old_palette_64",
+	ChunkLayer:         "layer",
+	ChunkCel:           "cel",
+	ChunkCelExtra:      "cel_extra",
+	ChunkColorProfile:  "color_profile",
+	ChunkExternalFiles: "external_files",
+	ChunkMask:          "mask",
+	ChunkPath:          "path",
+	ChunkTags:          "tags",
+	ChunkPalette:       "palette",
+	ChunkUserData:      "user_data",
+	ChunkSlice:         "slice",
+	ChunkTileset:       "tileset",
+}
+
+// String returns the name of the chunk type,
+// or its hexadecimal value if the type is unknown.
+func (t ChunkType) String() string {
+	if name, ok := chunkTypeNames[t]; ok {
+		return name
+	}
+	return "0x" + strconv.FormatUint(uint64(t), 16)
+}
+
+// Chunk is a chunk of an Aseprite file.
+type Chunk struct {
+	// Frame is the index of the frame that contains the chunk.
+	Frame int
+
+	// Type is the chunk type.
+	Type ChunkType
+
+	// Offset is the position of the chunk header in the file.
+	// The data starts 6 bytes later.
+	Offset int64
+
+	// Data is the chunk data without the header.
+	// It must not be modified.
+	Data []byte
+}
+
+// ChunkIterator iterates over the chunks of an Aseprite file in file order.
+type ChunkIterator struct {
+	frames []frame
+	frame  int
+	index  int
+	offset int64
+	chunk  Chunk
+}
+
+// Chunks reads an Aseprite file from r and returns an iterator over its chunks,
+// for tools that need to inspect chunks that Aseprite and Document do not expose.
+func Chunks(r io.Reader) (*ChunkIterator, error) {
+	var f file
+	if _, err := f.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	return newChunkIterator(f.frames), nil
+}
+
+func newChunkIterator(frames []frame) *ChunkIterator {
+	// the first chunk follows the file header and the first frame header
+	return &ChunkIterator{frames: frames, offset: 128 + 16}
+}
+
+// Next advances the iterator to the next chunk and reports whether there is one.
+func (it *ChunkIterator) Next() bool {
+	for it.frame < len(it.frames) && it.index == len(it.frames[it.frame].chunks) {
+		it.frame++
+		it.index = 0
+		it.offset += 16 // frame header
+	}
+
+	if it.frame == len(it.frames) {
+		return false
+	}
+
+	ch := it.frames[it.frame].chunks[it.index]
+	it.chunk = Chunk{
+		Frame:  it.frame,
+		Type:   ChunkType(ch.typ),
+		Offset: it.offset,
+		Data:   ch.raw,
+	}
+
+	it.index++
+	it.offset += 6 + int64(len(ch.raw))
+	return true
+}
+
+// Chunk returns the current chunk.
+func (it *ChunkIterator) Chunk() Chunk {
+	return it.chunk
+}
+
+// ChunkHandler decodes a chunk during Read.
+// Handlers are called in file order before the frames are decoded.
+// A non-nil value is stored in Aseprite.ChunkValues.
+// An error stops the decoding and is returned by Read.
+// The chunk data is the data of the file, which Read does not change,
+// and must not be modified.
+type ChunkHandler func(ch Chunk) (interface{}, error)
+
+// ChunkValue is a value returned by a ChunkHandler.
+type ChunkValue struct {
+	// Frame is the index of the frame that contains the chunk.
+	Frame int
+
+	// Type is the type of the chunk.
+	Type ChunkType
+
+	// Value is the value returned by the handler.
+	Value interface{}
+}
+
+// handleChunks calls the chunk handlers of opts for every chunk of the file.
+func (f *file) handleChunks(opts *Options) ([]ChunkValue, error) {
+	if opts == nil || len(opts.ChunkHandlers) == 0 {
+		return nil, nil
+	}
+
+	var values []ChunkValue
+	for it := newChunkIterator(f.frames); it.Next(); {
+		ch := it.Chunk()
+		handler, ok := opts.ChunkHandlers[ch.Type]
+		if !ok {
+			continue
+		}
+
+		v, err := handler(ch)
+		if err != nil {
+			return nil, err
+		} else if v != nil {
+			values = append(values, ChunkValue{ch.Frame, ch.Type, v})
+		}
+	}
+
+	return values, nil
+}
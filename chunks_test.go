@@ -0,0 +1,93 @@
+package aseprite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func TestChunks(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/slime_paletted.aseprite")
+	require.NoError(t, err)
+
+	it, err := Chunks(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	types := make(map[ChunkType]int)
+	frame, n := 0, 0
+	for it.Next() {
+		ch := it.Chunk()
+		require.True(t, ch.Frame == frame || ch.Frame == frame+1, "frame order", ch.Frame)
+		frame = ch.Frame
+
+		// the offset points at the chunk header in the file
+		size := binary.LittleEndian.Uint32(raw[ch.Offset:])
+		typ := binary.LittleEndian.Uint16(raw[ch.Offset+4:])
+		require.True(t, int(size) == 6+len(ch.Data) && ChunkType(typ) == ch.Type, "header", n)
+		require.True(t, bytes.Equal(raw[ch.Offset+6:ch.Offset+int64(size)], ch.Data), "data", n)
+
+		types[ch.Type]++
+		n++
+	}
+
+	require.True(t, frame == 9, "frames", frame)
+	require.True(t, types[ChunkLayer] > 0 && types[ChunkCel] > 0 && types[ChunkTags] == 1 && types[ChunkPalette] == 1, "types", types)
+	require.True(t, !it.Next(), "exhausted")
+}
+
+func TestChunkTypeString(t *testing.T) {
+	require.True(t, ChunkCel.String() == "cel", ChunkCel.String())
+	require.True(t, ChunkType(0x7777).String() == "0x7777", ChunkType(0x7777).String())
+}
+
+func TestChunkHandlers(t *testing.T) {
+	doc := Document{
+		Width:  2,
+		Height: 2,
+		Layers: []Layer{{Name: "layer", Parent: -1, Visible: true, Opacity: 255}},
+		Frames: []DocumentFrame{
+			{Duration: 100 * time.Millisecond, Cels: []Cel{{Layer: 0, Image: image.NewNRGBA(image.Rect(0, 0, 2, 2)), Opacity: 255}}},
+			{Duration: 100 * time.Millisecond},
+		},
+		Tags: []Tag{{Name: "tag"}},
+	}
+
+	raw := encodeWithChunk(t, &doc, func(frame int) chunk {
+		return chunk{0x7777, []byte{byte(10 + frame)}}
+	})
+
+	var tags int
+	opts := Options{
+		ChunkHandlers: map[ChunkType]ChunkHandler{
+			0x7777: func(ch Chunk) (interface{}, error) {
+				return int(ch.Data[0]), nil
+			},
+			// handlers of known chunk types do not replace the decoding of the package
+			ChunkTags: func(ch Chunk) (interface{}, error) {
+				tags++
+				return nil, nil
+			},
+		},
+	}
+
+	spr, err := ReadWithOptions(bytes.NewReader(raw), &opts)
+	require.NoError(t, err)
+	require.True(t, tags == 1 && len(spr.Tags) == 1, "tags")
+	require.True(t, len(spr.ChunkValues) == 2, "values", spr.ChunkValues)
+	for i, v := range spr.ChunkValues {
+		require.True(t, v.Frame == i && v.Type == 0x7777 && v.Value == 10+i, "value", i, v)
+	}
+
+	errCustom := errors.New("custom")
+	opts.ChunkHandlers[0x7777] = func(ch Chunk) (interface{}, error) {
+		return nil, errCustom
+	}
+	_, err = ReadWithOptions(bytes.NewReader(raw), &opts)
+	require.True(t, err == errCustom, "error", err)
+}
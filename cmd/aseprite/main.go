@@ -0,0 +1,335 @@
+// Command aseprite exports sprite sheets from Aseprite files
+// without the Aseprite application.
+//
+// Usage:
+//
+//	aseprite export [flags] file.aseprite
+//	aseprite info file.aseprite
+//	aseprite frames [flags] file.aseprite
+//
+// The export command writes the atlas as a PNG image and
+// optionally the JSON data file of Aseprite's sprite sheet export.
+// The info command prints the dimensions, frames, tags, layers and slices.
+// The frames command writes every frame as a separate PNG image.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/askeladdk/aseprite"
+)
+
+const usage = `usage: aseprite <command> [flags] file.aseprite
+
+commands:
+  export   write the atlas image and JSON data file
+  info     print the dimensions, frames, tags, layers and slices
+  frames   write every frame as a separate image
+
+Run 'aseprite <command> -h' for the flags of a command.
+`
+
+// errNoCommand is returned by run when no command is given.
+var errNoCommand = errors.New("no command")
+
+func main() {
+	err := run(os.Args[1:], os.Stdout, os.Stderr)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		// help that was asked for is not an error
+	case errors.Is(err, errNoCommand):
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "aseprite:", err)
+		os.Exit(2)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return errNoCommand
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "export":
+		return runExport(args, stderr)
+	case "info":
+		return runInfo(args, stdout, stderr)
+	case "frames":
+		return runFrames(args, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+var layouts = map[string]aseprite.Layout{
+	"pow2":       aseprite.LayoutPowerOfTwo,
+	"horizontal": aseprite.LayoutHorizontal,
+	"vertical":   aseprite.LayoutVertical,
+	"columns":    aseprite.LayoutColumns,
+	"tag-rows":   aseprite.LayoutTagRows,
+	"square":     aseprite.LayoutSquare,
+	"packed":     aseprite.LayoutPacked,
+}
+
+func runExport(args []string, stderr io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var (
+		opts     aseprite.Options
+		jsonOpts aseprite.JSONOptions
+	)
+
+	sheet := fs.String("sheet", "", "atlas image `file` (default: input file name with .png extension)")
+	data := fs.String("data", "", "JSON data `file` (default: no data file)")
+	layout := fs.String("layout", "pow2", "atlas `layout`: pow2, horizontal, vertical, columns, tag-rows, square or packed")
+	format := fs.String("format", "hash", "JSON frames `format`: hash or array")
+	fs.IntVar(&opts.Columns, "columns", 1, "number of columns of the columns layout")
+	fs.IntVar(&opts.MaxSize.X, "max-width", 0, "maximum page width of the packed layout")
+	fs.IntVar(&opts.MaxSize.Y, "max-height", 0, "maximum page height of the packed layout")
+	fs.BoolVar(&opts.PowerOfTwo, "pow2", false, "round page dimensions up to powers of two")
+	fs.BoolVar(&opts.Trim, "trim", false, "trim transparent frame borders")
+	fs.BoolVar(&opts.Dedupe, "dedupe", false, "store identical frames once")
+	fs.IntVar(&opts.BorderPadding, "border", 0, "border padding in pixels")
+	fs.IntVar(&opts.Spacing, "spacing", 0, "spacing between frames in pixels")
+	fs.IntVar(&opts.Extrude, "extrude", 0, "number of pixels to extrude frame edges")
+
+	name, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var ok bool
+	if opts.Layout, ok = layouts[*layout]; !ok {
+		return fmt.Errorf("unknown layout %q", *layout)
+	}
+
+	switch *format {
+	case "hash":
+		jsonOpts.Format = aseprite.JSONHash
+	case "array":
+		jsonOpts.Format = aseprite.JSONArray
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	spr, err := readFile(name, &opts)
+	if err != nil {
+		return err
+	}
+
+	if *sheet == "" {
+		*sheet = trimExt(name) + ".png"
+	}
+
+	if *data != "" && len(spr.Pages) > 1 {
+		return fmt.Errorf("the frames need %d pages but the JSON data file describes one; increase -max-width or -max-height", len(spr.Pages))
+	}
+
+	for i, page := range spr.Pages {
+		filename := *sheet
+		if len(spr.Pages) > 1 {
+			filename = fmt.Sprintf("%s-%d%s", trimExt(*sheet), i, filepath.Ext(*sheet))
+		}
+		if err := writePNG(filename, page); err != nil {
+			return err
+		}
+	}
+
+	if *data == "" {
+		return nil
+	}
+
+	jsonOpts.Image = filepath.Base(*sheet)
+	jsonOpts.Title = filepath.Base(trimExt(name))
+
+	return writeFile(*data, func(w io.Writer) error {
+		return aseprite.EncodeJSON(w, spr, &jsonOpts)
+	})
+}
+
+func runInfo(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	name, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	spr, err := readFile(name, nil)
+	if err != nil {
+		return err
+	}
+
+	var size image.Point
+	var duration time.Duration
+	if len(spr.Frames) > 0 {
+		size = spr.Frames[0].Size
+	}
+	for _, fr := range spr.Frames {
+		duration += fr.Duration
+	}
+
+	fmt.Fprintf(stdout, "size: %dx%d\n", size.X, size.Y)
+	fmt.Fprintf(stdout, "atlas: %dx%d\n", spr.Bounds().Dx(), spr.Bounds().Dy())
+	fmt.Fprintf(stdout, "color: %s\n", colorName(spr.Image))
+
+	fmt.Fprintf(stdout, "frames: %d (%v)\n", len(spr.Frames), duration)
+	for i, fr := range spr.Frames {
+		fmt.Fprintf(stdout, "  %d: %v %v\n", i, fr.Bounds, fr.Duration)
+	}
+
+	fmt.Fprintf(stdout, "tags: %d\n", len(spr.Tags))
+	for _, t := range spr.Tags {
+		fmt.Fprintf(stdout, "  %s: %d-%d %s", t.Name, t.Lo, t.Hi, t.LoopDirection)
+		if t.Repeat > 0 {
+			fmt.Fprintf(stdout, " x%d", t.Repeat)
+		}
+		fmt.Fprintln(stdout)
+	}
+
+	fmt.Fprintf(stdout, "layers: %d\n", len(spr.Layers))
+	for _, l := range spr.Layers {
+		indent := "  "
+		for p := l.Parent; p >= 0; p = spr.Layers[p].Parent {
+			indent += "  "
+		}
+		fmt.Fprintf(stdout, "%s%s:", indent, l.Name)
+		switch {
+		case l.Group:
+			fmt.Fprint(stdout, " group")
+		default:
+			fmt.Fprintf(stdout, " %s %d", l.BlendMode, l.Opacity)
+		}
+		if !l.Visible {
+			fmt.Fprint(stdout, " hidden")
+		}
+		if l.Reference {
+			fmt.Fprint(stdout, " reference")
+		}
+		fmt.Fprintln(stdout)
+	}
+
+	fmt.Fprintf(stdout, "slices: %d\n", len(spr.Slices))
+	for _, s := range spr.Slices {
+		fmt.Fprintf(stdout, "  %s: frame %d %v\n", s.Name, s.Frame, s.Bounds)
+	}
+
+	return nil
+}
+
+func runFrames(args []string, stderr io.Writer) error {
+	fs := flag.NewFlagSet("frames", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	dir := fs.String("dir", ".", "output `directory`")
+	prefix := fs.String("prefix", "", "file name `prefix` (default: input file name)")
+
+	name, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	spr, err := readFile(name, nil)
+	if err != nil {
+		return err
+	}
+
+	if *prefix == "" {
+		*prefix = filepath.Base(trimExt(name))
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+
+	for i, fr := range spr.Frames {
+		img := image.NewNRGBA(image.Rectangle{Max: fr.Size})
+		draw.Draw(img, fr.Bounds.Sub(fr.Bounds.Min).Add(fr.Offset), spr.Pages[fr.Page], fr.Bounds.Min, draw.Src)
+
+		filename := filepath.Join(*dir, fmt.Sprintf("%s-%d.png", *prefix, i))
+		if err := writePNG(filename, img); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseFlags parses the flags and returns the single file argument.
+func parseFlags(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", errors.New("expected a single input file")
+	}
+	return fs.Arg(0), nil
+}
+
+func readFile(name string, opts *aseprite.Options) (*aseprite.Aseprite, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	spr, err := aseprite.ReadWithOptions(f, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return spr, nil
+}
+
+func writePNG(name string, img image.Image) error {
+	return writeFile(name, func(w io.Writer) error {
+		return png.Encode(w, img)
+	})
+}
+
+// writeFile creates the named file and writes it using write.
+func writeFile(name string, write func(io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return f.Close()
+}
+
+func trimExt(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+func colorName(img image.Image) string {
+	switch img.(type) {
+	case *image.Paletted:
+		return "indexed"
+	case *aseprite.GrayAlpha:
+		return "grayscale"
+	default:
+		return "rgba"
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+const testFile = "../../testfiles/slime_paletted.aseprite"
+
+func decodePNG(t *testing.T, name string) image.Image {
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	require.NoError(t, err)
+	return img
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	sheet, data := filepath.Join(dir, "slime.png"), filepath.Join(dir, "slime.json")
+
+	err := run([]string{"export", "-sheet", sheet, "-data", data, "-layout", "horizontal", "-trim", "-spacing", "1", "-format", "array", testFile}, io.Discard, io.Discard)
+	require.NoError(t, err)
+
+	img := decodePNG(t, sheet)
+
+	raw, err := os.ReadFile(data)
+	require.NoError(t, err)
+
+	var doc struct {
+		Frames []struct{ Filename string }
+		Meta   struct {
+			Image string
+			Size  struct{ W, H int }
+		}
+	}
+	require.NoError(t, json.Unmarshal(raw, &doc))
+	require.True(t, len(doc.Frames) == 10, "frames", len(doc.Frames))
+	require.True(t, doc.Frames[3].Filename == "slime_paletted 3.aseprite", "filename", doc.Frames[3].Filename)
+	require.True(t, doc.Meta.Image == "slime.png", "image", doc.Meta.Image)
+	require.True(t, doc.Meta.Size.W == img.Bounds().Dx() && doc.Meta.Size.H == img.Bounds().Dy(), "size")
+}
+
+func TestExportPages(t *testing.T) {
+	dir := t.TempDir()
+	sheet := filepath.Join(dir, "slime.png")
+
+	err := run([]string{"export", "-sheet", sheet, "-layout", "packed", "-max-width", "64", "-max-height", "64", testFile}, io.Discard, io.Discard)
+	require.NoError(t, err)
+
+	for _, name := range []string{"slime-0.png", "slime-4.png"} {
+		img := decodePNG(t, filepath.Join(dir, name))
+		require.True(t, img.Bounds().Dx() <= 64 && img.Bounds().Dy() <= 64, "page size", name)
+	}
+
+	err = run([]string{"export", "-sheet", sheet, "-data", filepath.Join(dir, "slime.json"), "-layout", "packed", "-max-width", "64", "-max-height", "64", testFile}, io.Discard, io.Discard)
+	require.True(t, err != nil, "expected error for multiple pages with data file")
+}
+
+func TestInfo(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, run([]string{"info", testFile}, &b, io.Discard))
+
+	out := b.String()
+	for _, want := range []string{"size: 32x64\n", "color: indexed\n", "frames: 10 ", "  Up: 0-3 pingpong\n", "  base: normal 255 hidden\n", "slices: 0\n"} {
+		require.True(t, strings.Contains(out, want), "missing", want, out)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, run([]string{"frames", "-dir", dir, "-prefix", "slime", testFile}, io.Discard, io.Discard))
+
+	for i := 0; i < 10; i++ {
+		img := decodePNG(t, filepath.Join(dir, "slime-"+strconv.Itoa(i)+".png"))
+		require.True(t, img.Bounds().Size() == image.Pt(32, 64), "frame size", i)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	require.True(t, errors.Is(run(nil, io.Discard, io.Discard), errNoCommand), "no command")
+	require.True(t, errors.Is(run([]string{"help"}, io.Discard, io.Discard), flag.ErrHelp), "help")
+	require.True(t, errors.Is(run([]string{"info", "-h"}, io.Discard, io.Discard), flag.ErrHelp), "info help")
+	require.True(t, run([]string{"bogus"}, io.Discard, io.Discard) != nil, "unknown command")
+	require.True(t, run([]string{"export", "-layout", "bogus", testFile}, io.Discard, io.Discard) != nil, "unknown layout")
+	require.True(t, run([]string{"info"}, io.Discard, io.Discard) != nil, "no file")
+}
@@ -8,8 +8,14 @@ import (
 
 // Read decodes an Aseprite image from r.
 func Read(r io.Reader) (*Aseprite, error) {
+	return ReadWithOptions(r, nil)
+}
+
+// ReadWithOptions decodes an Aseprite image from r using the given options.
+// A nil opts uses the default options.
+func ReadWithOptions(r io.Reader, opts *Options) (*Aseprite, error) {
 	var spr Aseprite
-	if err := spr.readFrom(r); err != nil {
+	if err := spr.readFrom(r, opts); err != nil {
 		return nil, err
 	}
 
@@ -24,15 +30,35 @@ func Decode(r io.Reader) (image.Image, error) {
 // DecodeConfig returns the color model and dimensions of an Aseprite image
 // without decoding the entire image.
 func DecodeConfig(r io.Reader) (image.Config, error) {
+	return DecodeConfigWithOptions(r, nil)
+}
+
+// DecodeConfigWithOptions returns the color model and dimensions of
+// an Aseprite image decoded with the given options
+// without decoding the entire image.
+// The dimensions are those of the first atlas page.
+// A nil opts uses the default options.
+func DecodeConfigWithOptions(r io.Reader, opts *Options) (image.Config, error) {
 	var f file
 
 	if _, err := f.ReadFrom(r); err != nil {
 		return image.Config{}, err
 	}
 
-	fw, fh := factorPowerOfTwo(len(f.frames))
-	if f.framew > f.frameh {
-		fw, fh = fh, fw
+	var frames []image.Image
+
+	// the sizes of trimmed and deduplicated frames are only known after decoding them
+	if opts.wholeFrames() {
+		var err error
+		if frames, err = f.decode(opts); err != nil {
+			return image.Config{}, err
+		}
+	}
+
+	srcs := f.frameSources(opts, frames)
+	pages, _, _, err := f.atlasLayout(opts, srcs, frameSlots(opts, frames, srcs))
+	if err != nil {
+		return image.Config{}, err
 	}
 
 	var colorModel color.Model
@@ -42,15 +68,15 @@ func DecodeConfig(r io.Reader) (image.Config, error) {
 		f.initPalette()
 		colorModel = f.palette
 	case 16:
-		colorModel = color.Gray16Model
+		colorModel = GrayAlphaModel
 	default:
 		colorModel = color.RGBAModel
 	}
 
 	return image.Config{
 		ColorModel: colorModel,
-		Width:      f.framew * fw,
-		Height:     f.frameh * fh,
+		Width:      pages[0].Dx(),
+		Height:     pages[0].Dy(),
 	}, nil
 }
 
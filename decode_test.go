@@ -1,10 +1,13 @@
 package aseprite
 
 import (
+	"bytes"
+	"encoding/binary"
 	"image"
 	"image/color"
 	"image/png"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/askeladdk/aseprite/internal/require"
@@ -108,7 +111,7 @@ func TestDecodeConfig(t *testing.T) {
 			Name:     "grayscale",
 			Filename: "./testfiles/slime_grayscale.aseprite",
 			ImageConfig: image.Config{
-				ColorModel: color.Gray16Model,
+				ColorModel: GrayAlphaModel,
 				Width:      128,
 				Height:     256,
 			},
@@ -144,3 +147,69 @@ func TestDecodeConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestFrameImage(t *testing.T) {
+	for _, tt := range []struct {
+		Filename string
+		Tag      string
+		Frames   int
+	}{
+		{"./testfiles/slime_paletted.aseprite", "Down", 5},
+		{"./testfiles/slime_grayscale.aseprite", "Up", 4},
+		{"./testfiles/blendtest.aseprite", "", 0},
+	} {
+		t.Run(tt.Filename, func(t *testing.T) {
+			f, err := os.Open(tt.Filename)
+			require.NoError(t, err)
+			defer f.Close()
+
+			spr, err := Read(f)
+			require.NoError(t, err)
+
+			for i, fr := range spr.Frames {
+				img := spr.FrameImage(i)
+				require.True(t, reflect.TypeOf(img) == reflect.TypeOf(spr.Image), "type", i)
+				require.True(t, img.Bounds() == fr.Bounds, "bounds", i)
+
+				p := fr.Bounds.Min
+				require.True(t, img.At(p.X, p.Y) == spr.Image.At(p.X, p.Y), "pixel", i)
+			}
+
+			// the frame images share the pixels of the atlas
+			if img, ok := spr.FrameImage(0).(*image.Paletted); ok {
+				p := spr.Frames[0].Bounds.Min
+				img.SetColorIndex(p.X, p.Y, img.ColorIndexAt(p.X, p.Y)+1)
+				require.True(t, spr.Image.(*image.Paletted).ColorIndexAt(p.X, p.Y) == img.ColorIndexAt(p.X, p.Y), "shared")
+			}
+
+			images := spr.TagImages(tt.Tag)
+			require.True(t, len(images) == tt.Frames, "tag images", len(images))
+			if tag, ok := spr.FindTag(tt.Tag); ok {
+				for i, img := range images {
+					require.True(t, img.Bounds() == spr.Frames[int(tag.Lo)+i].Bounds, "tag image", i)
+				}
+			}
+
+			require.True(t, spr.FrameImage(-1) == nil && spr.FrameImage(len(spr.Frames)) == nil, "frame out of range")
+
+			spr.Tags = append(spr.Tags, Tag{Name: "bad", Lo: 1, Hi: 0})
+			require.True(t, spr.TagImages("bad") == nil, "tag out of range")
+		})
+	}
+}
+
+func TestDecodeNoFrames(t *testing.T) {
+	// a file header without frames
+	raw := make([]byte, 128)
+	binary.LittleEndian.PutUint32(raw[0:], 128)
+	binary.LittleEndian.PutUint16(raw[4:], 0xA5E0)
+	binary.LittleEndian.PutUint16(raw[8:], 16)
+	binary.LittleEndian.PutUint16(raw[10:], 16)
+	binary.LittleEndian.PutUint16(raw[12:], 32)
+
+	_, err := Read(bytes.NewReader(raw))
+	require.True(t, err == errNoFrames, "read", err)
+
+	_, err = DecodeConfig(bytes.NewReader(raw))
+	require.True(t, err == errNoFrames, "config", err)
+}
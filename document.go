@@ -0,0 +1,318 @@
+package aseprite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"reflect"
+	"time"
+)
+
+// ColorMode enumerates the color modes of a document.
+type ColorMode uint8
+
+const (
+	// ColorRGBA stores pixels as 8-bit non-alpha-premultiplied RGBA colors.
+	ColorRGBA ColorMode = iota
+
+	// ColorGrayscale stores pixels as 8-bit gray values with an 8-bit alpha channel.
+	ColorGrayscale
+
+	// ColorIndexed stores pixels as 8-bit indices into the palette.
+	ColorIndexed
+)
+
+// bpp returns the number of bits per pixel of the color mode.
+func (m ColorMode) bpp() int {
+	switch m {
+	case ColorGrayscale:
+		return 16
+	case ColorIndexed:
+		return 8
+	default:
+		return 32
+	}
+}
+
+// Document is a layered sprite that can be written as an Aseprite file.
+// Unlike Aseprite, which holds flattened frames on an atlas,
+// a Document keeps every layer and cel separate.
+type Document struct {
+	// Width and Height are the size of the canvas.
+	Width, Height int
+
+	// ColorMode is the color mode of the cel images.
+	ColorMode ColorMode
+
+	// Palette is the color palette of the sprite.
+	// It is required for indexed documents.
+	// If it is empty for other documents, a gray ramp is written instead.
+	Palette color.Palette
+
+	// Transparent is the index of the transparent color of indexed documents.
+	Transparent uint8
+
+	// Layers lists all layers in order from bottom to top.
+	// Group layers precede the layers that they contain.
+	Layers []Layer
+
+	// Frames lists all frames.
+	Frames []DocumentFrame
+
+	// Tags lists all animation tags.
+	Tags []Tag
+
+	// Slices lists all slice keys.
+	// Consecutive keys with the same ID and name and increasing frames
+	// form a single slice.
+	// The bounds of a slice are relative to the canvas.
+	Slices []Slice
+
+	// src is the file that the document was read from, if any.
+	src *docSource
+}
+
+// DocumentFrame is a single frame of a document.
+type DocumentFrame struct {
+	// Duration is the time that the frame is displayed for.
+	Duration time.Duration
+
+	// Cels lists the cels of the frame, at most one per layer.
+	Cels []Cel
+}
+
+// Cel is the image of a layer in a single frame.
+type Cel struct {
+	// Layer is the index of the layer that the cel belongs to.
+	// It cannot be a group layer.
+	Layer int
+
+	// Image is the image of the cel.
+	// Its bounds are the position and size of the cel on the canvas.
+	// Images are converted to the color mode of the document.
+	// Paletted images in indexed documents are assumed to use the document palette.
+	Image image.Image
+
+	// Opacity is the opacity of the cel.
+	Opacity byte
+
+	// Data is optional user data.
+	Data []byte
+
+	// Color is the optional cel color.
+	Color color.Color
+}
+
+// ReadDocument reads the layers, cels, tags and slices of an Aseprite file
+// from r without flattening them.
+//
+// The document remembers the chunks of the file.
+// Encode writes the chunks that are not represented by the document
+// and the chunks that have not been modified exactly as they were read,
+// so that programs can edit a file without losing data.
+func ReadDocument(r io.Reader) (*Document, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var f file
+	if _, err := f.ReadFrom(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+
+	return f.document(raw[:128])
+}
+
+// docSource holds the chunks of the file that a document was read from
+// and a copy of the parts of the document as they were read,
+// which tells the parts that have been modified.
+type docSource struct {
+	header []byte
+	frames [][]chunk
+
+	// layerChunks are the layer chunks of the first frame
+	layerChunks [][]byte
+
+	palette color.Palette
+	layers  []Layer
+	tags    []Tag
+	slices  []Slice
+
+	// cels[frame][layer] is the cel as it was read, or nil
+	cels [][]*celSource
+}
+
+// celSource is a cel as it was read.
+type celSource struct {
+	cel    Cel
+	bounds image.Rectangle
+	pix    []byte
+}
+
+// equal reports whether c is equal to the cel as it was read.
+func (s *celSource) equal(doc *Document, c Cel) bool {
+	return c.Layer == s.cel.Layer &&
+		c.Opacity == s.cel.Opacity &&
+		bytes.Equal(c.Data, s.cel.Data) && (c.Data == nil) == (s.cel.Data == nil) &&
+		reflect.DeepEqual(c.Color, s.cel.Color) &&
+		c.Image.Bounds() == s.bounds &&
+		bytes.Equal(doc.celPixels(c.Image), s.pix)
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// document converts the chunks of the file to a document.
+func (f *file) document(header []byte) (*Document, error) {
+	f.initPalette()
+
+	if err := f.initLayers(); err != nil {
+		return nil, err
+	}
+
+	doc := Document{
+		Width:       f.framew,
+		Height:      f.frameh,
+		Palette:     f.palette,
+		Transparent: f.transparent,
+		Layers:      f.buildLayers(),
+		Frames:      make([]DocumentFrame, len(f.frames)),
+		Tags:        f.buildTags(),
+		Slices:      f.buildSlices(),
+	}
+
+	switch f.bpp {
+	case 8:
+		doc.ColorMode = ColorIndexed
+	case 16:
+		doc.ColorMode = ColorGrayscale
+	}
+
+	src := docSource{
+		header: append([]byte{}, header...),
+		frames: make([][]chunk, len(f.frames)),
+		cels:   make([][]*celSource, len(f.frames)),
+	}
+
+	for _, ch := range f.frames[0].chunks {
+		if ch.typ == 0x2004 {
+			src.layerChunks = append(src.layerChunks, ch.raw)
+		}
+	}
+
+	for i, fr := range f.frames {
+		doc.Frames[i].Duration = fr.dur
+		src.frames[i] = fr.chunks
+		src.cels[i] = make([]*celSource, len(f.layers))
+
+		for j, ch := range fr.chunks {
+			if ch.typ != 0x2005 {
+				continue
+			}
+
+			s, err := f.documentCel(&doc, src.cels, i, ch.raw)
+			if err != nil {
+				return nil, err
+			}
+
+			if j < len(fr.chunks)-1 {
+				if ud := fr.chunks[j+1]; ud.typ == 0x2020 {
+					data, col := parseUserData(ud.raw)
+					s.cel.Data, s.cel.Color = cloneBytes(data), col
+				}
+			}
+
+			src.cels[i][s.cel.Layer] = s
+			doc.Frames[i].Cels = append(doc.Frames[i].Cels, s.cel)
+			s.cel.Data = cloneBytes(s.cel.Data)
+		}
+	}
+
+	// the document must not share memory with the chunks
+	doc.Layers = cloneLayers(doc.Layers)
+	doc.Slices = cloneSlices(doc.Slices)
+
+	src.palette = append(color.Palette(nil), doc.Palette...)
+	src.layers = cloneLayers(doc.Layers)
+	src.tags = append([]Tag(nil), doc.Tags...)
+	src.slices = cloneSlices(doc.Slices)
+	doc.src = &src
+	return &doc, nil
+}
+
+// documentCel decodes the cel chunk raw of frame i.
+// Linked cels share the image of the cel that they link to.
+func (f *file) documentCel(doc *Document, cels [][]*celSource, i int, raw []byte) (*celSource, error) {
+	layer := int(binary.LittleEndian.Uint16(raw))
+	if layer >= len(f.layers) || f.layers[layer].typ != 0 {
+		return nil, errors.New("cel layer is not an image layer")
+	}
+
+	if celType(raw) == 1 {
+		link := int(binary.LittleEndian.Uint16(raw[16:]))
+		if link >= i || cels[link][layer] == nil {
+			return nil, errors.New("invalid linked cel")
+		}
+		s := *cels[link][layer]
+		s.cel.Opacity = raw[6]
+		s.cel.Data, s.cel.Color = nil, nil
+		return &s, nil
+	}
+
+	bounds, pix, err := celImage(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	n := bounds.Dx() * bounds.Dy()
+	if len(pix) != n*doc.ColorMode.bpp()/8 {
+		return nil, errors.New("invalid cel size")
+	}
+
+	var img image.Image
+	switch doc.ColorMode {
+	case ColorIndexed:
+		// uncompressed pixels are the chunk data, which must not change
+		pix = cloneBytes(pix)
+		for j := range pix {
+			if int(pix[j]) >= len(doc.Palette) {
+				pix[j] = doc.Transparent
+			}
+		}
+		img = &image.Paletted{Pix: cloneBytes(pix), Stride: bounds.Dx(), Rect: bounds, Palette: doc.Palette}
+	case ColorGrayscale:
+		img = &GrayAlpha{Pix: cloneBytes(pix), Stride: 2 * bounds.Dx(), Rect: bounds}
+	default:
+		img = &image.NRGBA{Pix: cloneBytes(pix), Stride: 4 * bounds.Dx(), Rect: bounds}
+	}
+
+	return &celSource{
+		cel:    Cel{Layer: layer, Image: img, Opacity: raw[6]},
+		bounds: bounds,
+		pix:    pix,
+	}, nil
+}
+
+func cloneLayers(layers []Layer) []Layer {
+	layers = append([]Layer(nil), layers...)
+	for i := range layers {
+		layers[i].Data = cloneBytes(layers[i].Data)
+	}
+	return layers
+}
+
+func cloneSlices(slices []Slice) []Slice {
+	slices = append([]Slice(nil), slices...)
+	for i := range slices {
+		slices[i].Data = cloneBytes(slices[i].Data)
+	}
+	return slices
+}
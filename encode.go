@@ -0,0 +1,807 @@
+package aseprite
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+// Encode writes doc to w as an Aseprite file.
+// Cel images are compressed and cels that share their image and opacity
+// with the cel of the same layer in an earlier frame are written as linked cels.
+//
+// If doc was read by ReadDocument, the chunks of the file that are not
+// represented by doc and the chunks of the parts of doc that have not been
+// modified are written unchanged. The chunks of modified palettes, layers,
+// cels, tags and slices are replaced.
+func Encode(w io.Writer, doc *Document) error {
+	if err := doc.validate(); err != nil {
+		return err
+	}
+
+	e := newEncoder(doc)
+	raw := e.header()
+
+	for i, fr := range doc.Frames {
+		var chunks []chunk
+		var err error
+		if doc.src != nil && i < len(doc.src.frames) {
+			chunks, err = e.sourceFrameChunks(i)
+		} else {
+			chunks, err = e.frameChunks(i)
+		}
+		if err != nil {
+			return err
+		}
+		raw = appendFrame(raw, fr.Duration, chunks)
+	}
+
+	binary.LittleEndian.PutUint32(raw, uint32(len(raw)))
+	_, err := w.Write(raw)
+	return err
+}
+
+type encoder struct {
+	doc     *Document
+	palette color.Palette
+	levels  []int
+	links   celLinks
+
+	// the parts of the document that differ from the file it was read from
+	paletteChanged, layersChanged, tagsChanged, slicesChanged bool
+
+	// sameLayers reports whether the document has as many layers as the file,
+	// so that every layer replaces the layer chunk at the same index.
+	sameLayers bool
+
+	// rewriteLayers reports whether all layer chunks are replaced.
+	rewriteLayers bool
+
+	// kept[frame][layer] reports whether the chunk of a cel is written unchanged.
+	kept [][]bool
+}
+
+func newEncoder(doc *Document) *encoder {
+	e := encoder{
+		doc:     doc,
+		palette: doc.palette(),
+		levels:  layerLevels(doc.Layers),
+		links:   make(celLinks, len(doc.Layers)),
+	}
+
+	if src := doc.src; src != nil {
+		e.paletteChanged = !reflect.DeepEqual(doc.Palette, src.palette)
+		e.layersChanged = !reflect.DeepEqual(doc.Layers, src.layers)
+		e.tagsChanged = !reflect.DeepEqual(doc.Tags, src.tags)
+		e.slicesChanged = !reflect.DeepEqual(doc.Slices, src.slices)
+		e.sameLayers = len(doc.Layers) == len(src.layers)
+		e.kept = make([][]bool, len(src.frames))
+
+		// the opacity of unchanged layer chunks is only valid if the header says so
+		opacityValid := binary.LittleEndian.Uint32(src.header[14:])&1 != 0
+		e.rewriteLayers = e.layersChanged && (!e.sameLayers || !opacityValid)
+	}
+
+	return &e
+}
+
+func (e *encoder) header() []byte {
+	doc := e.doc
+	raw := make([]byte, 128, 1024)
+
+	var flags uint32 = 1 // layer opacity is valid
+	if src := doc.src; src != nil {
+		copy(raw, src.header)
+		flags = binary.LittleEndian.Uint32(raw[14:])
+		if e.layersChanged {
+			flags |= 1
+		}
+		if e.rewriteLayers && !e.sameLayers {
+			flags &^= 4 // new layers do not have UUIDs
+		}
+	} else {
+		binary.LittleEndian.PutUint16(raw[18:], frameMillis(doc.Frames[0].Duration))
+		// square pixels and a 16x16 grid
+		raw[34], raw[35] = 1, 1
+		binary.LittleEndian.PutUint16(raw[40:], 16)
+		binary.LittleEndian.PutUint16(raw[42:], 16)
+	}
+
+	binary.LittleEndian.PutUint16(raw[4:], 0xA5E0)
+	binary.LittleEndian.PutUint16(raw[6:], uint16(len(doc.Frames)))
+	binary.LittleEndian.PutUint16(raw[8:], uint16(doc.Width))
+	binary.LittleEndian.PutUint16(raw[10:], uint16(doc.Height))
+	binary.LittleEndian.PutUint16(raw[12:], uint16(doc.ColorMode.bpp()))
+	binary.LittleEndian.PutUint32(raw[14:], flags)
+	if doc.ColorMode == ColorIndexed {
+		raw[28] = doc.Transparent
+	}
+	binary.LittleEndian.PutUint16(raw[32:], uint16(len(e.palette)))
+	return raw
+}
+
+// appendFrame appends a frame of the given duration and chunks to raw.
+func appendFrame(raw []byte, d time.Duration, chunks []chunk) []byte {
+	size := 16
+	for _, c := range chunks {
+		size += 6 + len(c.raw)
+	}
+
+	oldChunks := len(chunks)
+	if oldChunks > 0xffff {
+		oldChunks = 0xffff
+	}
+
+	var hdr [16]byte
+	binary.LittleEndian.PutUint32(hdr[0:], uint32(size))
+	binary.LittleEndian.PutUint16(hdr[4:], 0xF1FA)
+	binary.LittleEndian.PutUint16(hdr[6:], uint16(oldChunks))
+	binary.LittleEndian.PutUint16(hdr[8:], frameMillis(d))
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(len(chunks)))
+	raw = append(raw, hdr[:]...)
+
+	for _, c := range chunks {
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(6+len(c.raw)))
+		raw = binary.LittleEndian.AppendUint16(raw, uint16(c.typ))
+		raw = append(raw, c.raw...)
+	}
+
+	return raw
+}
+
+// frameChunks returns the chunks of frame i of a new document.
+func (e *encoder) frameChunks(i int) ([]chunk, error) {
+	var chunks []chunk
+
+	if i == 0 {
+		chunks = append(chunks, chunk{0x2007, srgbProfileChunk()}, e.paletteChunk())
+		for j := range e.doc.Layers {
+			chunks = append(chunks, e.layerChunks(j)...)
+		}
+	}
+
+	for _, c := range e.doc.Frames[i].Cels {
+		if c.Image == nil {
+			continue
+		}
+		cs, err := e.celChunks(c, i)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, cs...)
+	}
+
+	if i == 0 {
+		chunks = append(chunks, e.tagChunks()...)
+		chunks = append(chunks, e.sliceChunks()...)
+	}
+
+	return chunks, nil
+}
+
+// sourceFrameChunks returns the chunks of frame i of a document that was read from a file.
+// It replaces the chunks of the modified parts of the document and keeps the others.
+func (e *encoder) sourceFrameChunks(i int) ([]chunk, error) {
+	doc, src := e.doc, e.doc.src
+	orig := src.frames[i]
+	fr := doc.Frames[i]
+
+	var chunks []chunk
+	var layer int
+	var wrotePalette, wroteLayers, wroteTags, wroteSlices bool
+
+	// written[layer] reports whether the cel of the layer has been handled
+	written := make([]bool, len(doc.Layers))
+	e.kept[i] = make([]bool, len(doc.Layers))
+
+	for j := 0; j < len(orig); {
+		ch := orig[j]
+		n := 1
+
+		switch {
+		case ch.typ == 0x2005:
+			n = attached(orig, j, 2, 0x2006, 0x2020)
+			l := int(binary.LittleEndian.Uint16(ch.raw))
+			if l >= len(doc.Layers) || written[l] {
+				break
+			}
+			written[l] = true
+
+			c, ok := frameCel(fr, l)
+			if !ok {
+				break
+			}
+
+			if e.keepCel(i, c, ch.raw) {
+				chunks = append(chunks, orig[j:j+n]...)
+				break
+			}
+
+			cs, err := e.celChunks(c, i)
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, cs...)
+		case i > 0:
+			// only the first frame holds the palette, layers, tags and slices
+			chunks = append(chunks, ch)
+		case ch.typ == 0x0004 || ch.typ == 0x0011 || ch.typ == 0x2019:
+			if !e.paletteChanged {
+				chunks = append(chunks, ch)
+			} else if !wrotePalette {
+				chunks = append(chunks, e.paletteChunk())
+			}
+			wrotePalette = true
+		case ch.typ == 0x2004:
+			n = attached(orig, j, 1, 0x2020)
+			if !e.sameLayers {
+				if !wroteLayers {
+					for k := range doc.Layers {
+						chunks = append(chunks, e.layerChunks(k)...)
+					}
+				}
+			} else if e.rewriteLayers || !reflect.DeepEqual(doc.Layers[layer], src.layers[layer]) {
+				chunks = append(chunks, e.layerChunks(layer)...)
+			} else {
+				chunks = append(chunks, orig[j:j+n]...)
+			}
+			wroteLayers = true
+			layer++
+		case ch.typ == 0x2018:
+			// every tag is followed by its user data
+			n = attached(orig, j, int(binary.LittleEndian.Uint16(ch.raw)), 0x2020)
+			if !e.tagsChanged {
+				chunks = append(chunks, orig[j:j+n]...)
+			} else if !wroteTags {
+				chunks = append(chunks, e.tagChunks()...)
+			}
+			wroteTags = true
+		case ch.typ == 0x2022:
+			n = attached(orig, j, 1, 0x2020)
+			if !e.slicesChanged {
+				chunks = append(chunks, orig[j:j+n]...)
+			} else if !wroteSlices {
+				chunks = append(chunks, e.sliceChunks()...)
+			}
+			wroteSlices = true
+		default:
+			chunks = append(chunks, ch)
+		}
+
+		j += n
+	}
+
+	// new cels
+	for _, c := range fr.Cels {
+		if c.Image == nil || written[c.Layer] {
+			continue
+		}
+		cs, err := e.celChunks(c, i)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, cs...)
+	}
+
+	if i > 0 {
+		return chunks, nil
+	}
+
+	// parts that the file did not have
+	var head []chunk
+	if e.paletteChanged && !wrotePalette {
+		head = append(head, e.paletteChunk())
+	}
+	if e.layersChanged && !wroteLayers {
+		for k := range doc.Layers {
+			head = append(head, e.layerChunks(k)...)
+		}
+	}
+	chunks = append(head, chunks...)
+
+	if e.tagsChanged && !wroteTags {
+		chunks = append(chunks, e.tagChunks()...)
+	}
+	if e.slicesChanged && !wroteSlices {
+		chunks = append(chunks, e.sliceChunks()...)
+	}
+
+	return chunks, nil
+}
+
+// attached returns the number of chunks starting at j that consist of
+// the chunk at j and at most limit following chunks of the given types.
+func attached(chunks []chunk, j, limit int, types ...int) int {
+	n := 1
+	for n <= limit && j+n < len(chunks) {
+		found := false
+		for _, typ := range types {
+			found = found || chunks[j+n].typ == typ
+		}
+		if !found {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// frameCel returns the cel of the layer in fr.
+func frameCel(fr DocumentFrame, layer int) (Cel, bool) {
+	for _, c := range fr.Cels {
+		if c.Layer == layer && c.Image != nil {
+			return c, true
+		}
+	}
+	return Cel{}, false
+}
+
+// keepCel reports whether the chunk raw that c was read from in frame i
+// can be written unchanged.
+func (e *encoder) keepCel(i int, c Cel, raw []byte) bool {
+	s := e.doc.src.cels[i][c.Layer]
+	if s == nil || !s.equal(e.doc, c) {
+		return false
+	}
+
+	// a linked cel is only unchanged if the cel that it links to is
+	if celType(raw) == 1 && !e.kept[binary.LittleEndian.Uint16(raw[16:])][c.Layer] {
+		return false
+	}
+
+	e.kept[i][c.Layer] = true
+	e.links.find(c, i)
+	return true
+}
+
+func (e *encoder) paletteChunk() chunk {
+	return chunk{0x2019, paletteChunk(e.palette)}
+}
+
+// layerChunks returns the chunks of layer i.
+func (e *encoder) layerChunks(i int) []chunk {
+	l := e.doc.Layers[i]
+	raw := layerChunk(l, e.levels[i])
+
+	// keep unknown flags and the fields that follow the name
+	if e.sameLayers {
+		orig := e.doc.src.layerChunks[i]
+		const layerFlags = 127 // the flags of Layer
+		flags := binary.LittleEndian.Uint16(orig)&^layerFlags | binary.LittleEndian.Uint16(raw)&layerFlags
+		binary.LittleEndian.PutUint16(raw, flags)
+		raw = append(raw, orig[18+int(binary.LittleEndian.Uint16(orig[16:])):]...)
+	}
+
+	chunks := []chunk{{0x2004, raw}}
+	if l.Data != nil || l.Color != nil {
+		chunks = append(chunks, chunk{0x2020, userDataChunk(l.Data, l.Color)})
+	}
+	return chunks
+}
+
+// celChunks returns the chunks of cel c in frame i.
+func (e *encoder) celChunks(c Cel, i int) ([]chunk, error) {
+	var chunks []chunk
+
+	if link, ok := e.links.find(c, i); ok {
+		chunks = append(chunks, chunk{0x2005, linkedCelChunk(c, link)})
+	} else {
+		raw, err := e.doc.celChunk(c)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk{0x2005, raw})
+	}
+
+	if c.Data != nil || c.Color != nil {
+		chunks = append(chunks, chunk{0x2020, userDataChunk(c.Data, c.Color)})
+	}
+
+	return chunks, nil
+}
+
+func (e *encoder) tagChunks() []chunk {
+	if len(e.doc.Tags) == 0 {
+		return nil
+	}
+
+	chunks := []chunk{{0x2018, tagsChunk(e.doc.Tags)}}
+	// every tag is followed by its user data in tag order
+	for _, t := range e.doc.Tags {
+		chunks = append(chunks, chunk{0x2020, userDataChunk(nil, t.Color)})
+	}
+	return chunks
+}
+
+func (e *encoder) sliceChunks() []chunk {
+	var chunks []chunk
+	for _, keys := range groupSlices(e.doc.Slices) {
+		chunks = append(chunks, chunk{0x2022, sliceChunk(keys)})
+		if s := keys[0]; s.Data != nil || s.Color != nil {
+			chunks = append(chunks, chunk{0x2020, userDataChunk(s.Data, s.Color)})
+		}
+	}
+	return chunks
+}
+
+func (doc *Document) validate() error {
+	if doc.Width <= 0 || doc.Height <= 0 || doc.Width > 0xffff || doc.Height > 0xffff {
+		return errors.New("aseprite: invalid document size")
+	} else if len(doc.Frames) == 0 || len(doc.Frames) > 0xffff {
+		return errors.New("aseprite: invalid number of frames")
+	} else if doc.ColorMode > ColorIndexed {
+		return errors.New("aseprite: invalid color mode")
+	} else if len(doc.Palette) > 0xffff {
+		return errors.New("aseprite: palette too large")
+	}
+
+	if doc.ColorMode == ColorIndexed {
+		if len(doc.Palette) == 0 || len(doc.Palette) > 256 {
+			return errors.New("aseprite: indexed documents need a palette of 1 to 256 colors")
+		} else if int(doc.Transparent) >= len(doc.Palette) {
+			return errors.New("aseprite: transparent index out of range")
+		}
+	}
+
+	// the parent of a layer must be the last group at the level above it
+	var groups []int
+	for i, l := range doc.Layers {
+		level := 0
+		if l.Parent >= 0 {
+			for level < len(groups) && groups[level] != l.Parent {
+				level++
+			}
+			if level == len(groups) {
+				return errors.New("aseprite: layer parent is not an enclosing group")
+			}
+			level++
+		}
+		if l.Group {
+			groups = append(groups[:level], i)
+		} else {
+			groups = groups[:level]
+		}
+	}
+
+	for _, fr := range doc.Frames {
+		used := make([]bool, len(doc.Layers))
+		for _, c := range fr.Cels {
+			if c.Layer < 0 || c.Layer >= len(doc.Layers) || doc.Layers[c.Layer].Group {
+				return errors.New("aseprite: cel layer is not an image layer")
+			} else if used[c.Layer] {
+				return errors.New("aseprite: more than one cel per layer in a frame")
+			}
+			used[c.Layer] = true
+		}
+	}
+
+	if len(doc.Tags) > 0xffff {
+		return errors.New("aseprite: too many tags")
+	}
+
+	for _, t := range doc.Tags {
+		if t.Lo > t.Hi || int(t.Hi) >= len(doc.Frames) {
+			return errors.New("aseprite: tag frames out of range")
+		}
+	}
+
+	return nil
+}
+
+// palette returns the palette that is written to the file.
+func (doc *Document) palette() color.Palette {
+	if len(doc.Palette) > 0 {
+		return doc.Palette
+	}
+
+	p := make(color.Palette, 256)
+	for i := range p {
+		p[i] = color.NRGBA{uint8(i), uint8(i), uint8(i), 255}
+	}
+	return p
+}
+
+// layerLevels returns the child level of every layer.
+func layerLevels(layers []Layer) []int {
+	levels := make([]int, len(layers))
+	for i, l := range layers {
+		if l.Parent >= 0 {
+			levels[i] = levels[l.Parent] + 1
+		}
+	}
+	return levels
+}
+
+// frameMillis converts the frame duration d to milliseconds.
+func frameMillis(d time.Duration) uint16 {
+	ms := d.Milliseconds()
+	if ms < 0 {
+		return 0
+	} else if ms > 0xffff {
+		return 0xffff
+	}
+	return uint16(ms)
+}
+
+// celLinks maps the images and opacities of the cels of every layer
+// to the first frame that contains them.
+type celLinks []map[celLink]int
+
+type celLink struct {
+	image   image.Image
+	opacity byte
+}
+
+// find returns the earlier frame that contains the same cel as c.
+// Otherwise it records frame as the first frame that contains c.
+func (links celLinks) find(c Cel, frame int) (int, bool) {
+	// only images that can be used as map keys are linked
+	if !reflect.TypeOf(c.Image).Comparable() {
+		return 0, false
+	}
+
+	key := celLink{c.Image, c.Opacity}
+	if link, ok := links[c.Layer][key]; ok {
+		return link, true
+	}
+
+	if links[c.Layer] == nil {
+		links[c.Layer] = make(map[celLink]int)
+	}
+	links[c.Layer][key] = frame
+	return 0, false
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func appendColor(b []byte, c color.Color) []byte {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return append(b, n.R, n.G, n.B, n.A)
+}
+
+func srgbProfileChunk() []byte {
+	var raw [16]byte
+	binary.LittleEndian.PutUint16(raw[0:], 1) // sRGB
+	return raw[:]
+}
+
+func paletteChunk(p color.Palette) []byte {
+	raw := make([]byte, 20, 20+6*len(p))
+	binary.LittleEndian.PutUint32(raw[0:], uint32(len(p)))
+	binary.LittleEndian.PutUint32(raw[8:], uint32(len(p)-1))
+	for _, c := range p {
+		raw = append(raw, 0, 0) // flags
+		raw = appendColor(raw, c)
+	}
+	return raw
+}
+
+func layerChunk(l Layer, level int) []byte {
+	var flags uint16
+	for bit, set := range [...]bool{l.Visible, !l.Locked, l.LockMovement, l.Background, l.PreferLinked, l.Collapsed, l.Reference} {
+		if set {
+			flags |= 1 << bit
+		}
+	}
+
+	var typ uint16
+	if l.Group {
+		typ = 1
+	}
+
+	raw := make([]byte, 16, 18+len(l.Name))
+	binary.LittleEndian.PutUint16(raw[0:], flags)
+	binary.LittleEndian.PutUint16(raw[2:], typ)
+	binary.LittleEndian.PutUint16(raw[4:], uint16(level))
+	binary.LittleEndian.PutUint16(raw[10:], uint16(l.BlendMode))
+	raw[12] = l.Opacity
+	return appendString(raw, l.Name)
+}
+
+func userDataChunk(data []byte, c color.Color) []byte {
+	var flags uint32
+	if data != nil {
+		flags |= 1
+	}
+	if c != nil {
+		flags |= 2
+	}
+
+	raw := binary.LittleEndian.AppendUint32(nil, flags)
+	if data != nil {
+		raw = appendString(raw, string(data))
+	}
+	if c != nil {
+		raw = appendColor(raw, c)
+	}
+	return raw
+}
+
+// celHeader returns the common header of a cel chunk.
+func celHeader(c Cel, typ uint16) []byte {
+	pos := c.Image.Bounds().Min
+	raw := make([]byte, 16, 20)
+	binary.LittleEndian.PutUint16(raw[0:], uint16(c.Layer))
+	binary.LittleEndian.PutUint16(raw[2:], uint16(int16(pos.X)))
+	binary.LittleEndian.PutUint16(raw[4:], uint16(int16(pos.Y)))
+	raw[6] = c.Opacity
+	binary.LittleEndian.PutUint16(raw[7:], typ)
+	return raw
+}
+
+func linkedCelChunk(c Cel, frame int) []byte {
+	return binary.LittleEndian.AppendUint16(celHeader(c, 1), uint16(frame))
+}
+
+func (doc *Document) celChunk(c Cel) ([]byte, error) {
+	size := c.Image.Bounds().Size()
+	raw := celHeader(c, 2)
+	raw = binary.LittleEndian.AppendUint16(raw, uint16(size.X))
+	raw = binary.LittleEndian.AppendUint16(raw, uint16(size.Y))
+
+	b := bytes.NewBuffer(raw)
+	zw := zlib.NewWriter(b)
+	if _, err := zw.Write(doc.celPixels(c.Image)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// celPixels converts img to the pixel format of the color mode.
+func (doc *Document) celPixels(img image.Image) []byte {
+	r := img.Bounds()
+	bpp := doc.ColorMode.bpp() / 8
+	pix := make([]byte, 0, bpp*r.Dx()*r.Dy())
+
+	switch doc.ColorMode {
+	case ColorIndexed:
+		if src, ok := img.(*image.Paletted); ok {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				i := src.PixOffset(r.Min.X, y)
+				pix = append(pix, src.Pix[i:i+r.Dx()]...)
+			}
+			return pix
+		}
+
+		cache := make(map[color.NRGBA]uint8)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				if c.A == 0 {
+					pix = append(pix, doc.Transparent)
+					continue
+				}
+				index, ok := cache[c]
+				if !ok {
+					index = nearestVisible(doc.Palette, c, doc.Transparent)
+					cache[c] = index
+				}
+				pix = append(pix, index)
+			}
+		}
+	case ColorGrayscale:
+		if src, ok := img.(*GrayAlpha); ok {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				i := src.PixOffset(r.Min.X, y)
+				pix = append(pix, src.Pix[i:i+2*r.Dx()]...)
+			}
+			return pix
+		}
+
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				c := grayAlphaModel(img.At(x, y)).(GrayAlphaColor)
+				pix = append(pix, c.Y, c.A)
+			}
+		}
+	default:
+		if src, ok := img.(*image.NRGBA); ok {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				i := src.PixOffset(r.Min.X, y)
+				pix = append(pix, src.Pix[i:i+4*r.Dx()]...)
+			}
+			return pix
+		}
+
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				pix = appendColor(pix, img.At(x, y))
+			}
+		}
+	}
+
+	return pix
+}
+
+// nearestVisible returns the index of the palette color that is closest to c
+// as in color.Palette.Index, excluding the transparent index.
+func nearestVisible(p color.Palette, c color.Color, transparent uint8) uint8 {
+	cr, cg, cb, ca := c.RGBA()
+	best, bestDist := transparent, uint64(math.MaxUint64)
+	for i, pc := range p {
+		if i == int(transparent) {
+			continue
+		}
+		pr, pg, pb, pa := pc.RGBA()
+		dist := sqDiff(cr, pr) + sqDiff(cg, pg) + sqDiff(cb, pb) + sqDiff(ca, pa)
+		if dist < bestDist {
+			best, bestDist = uint8(i), dist
+		}
+	}
+	return best
+}
+
+// sqDiff returns the squared difference of x and y.
+func sqDiff(x, y uint32) uint64 {
+	d := int64(x) - int64(y)
+	return uint64(d * d)
+}
+
+func tagsChunk(tags []Tag) []byte {
+	raw := make([]byte, 10)
+	binary.LittleEndian.PutUint16(raw, uint16(len(tags)))
+	for _, t := range tags {
+		var tag [17]byte
+		binary.LittleEndian.PutUint16(tag[0:], t.Lo)
+		binary.LittleEndian.PutUint16(tag[2:], t.Hi)
+		tag[4] = byte(t.LoopDirection)
+		binary.LittleEndian.PutUint16(tag[5:], t.Repeat)
+		if t.Color != nil {
+			c := color.NRGBAModel.Convert(t.Color).(color.NRGBA)
+			tag[13], tag[14], tag[15] = c.R, c.G, c.B
+		}
+		raw = appendString(append(raw, tag[:]...), t.Name)
+	}
+	return raw
+}
+
+func sliceChunk(keys []Slice) []byte {
+	var flags uint32
+	for _, s := range keys {
+		if s.hasCenter() {
+			flags |= 1
+		}
+		if s.hasPivot() {
+			flags |= 2
+		}
+	}
+
+	raw := make([]byte, 12)
+	binary.LittleEndian.PutUint32(raw[0:], uint32(len(keys)))
+	binary.LittleEndian.PutUint32(raw[4:], flags)
+	raw = appendString(raw, keys[0].Name)
+
+	appendRect := func(r image.Rectangle) {
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(int32(r.Min.X)))
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(int32(r.Min.Y)))
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(r.Dx()))
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(r.Dy()))
+	}
+
+	for _, s := range keys {
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(s.Frame))
+		appendRect(s.Bounds)
+		if flags&1 != 0 {
+			appendRect(s.Center)
+		}
+		if flags&2 != 0 {
+			raw = binary.LittleEndian.AppendUint32(raw, uint32(int32(s.Pivot.X)))
+			raw = binary.LittleEndian.AppendUint32(raw, uint32(int32(s.Pivot.Y)))
+		}
+	}
+
+	return raw
+}
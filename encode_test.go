@@ -0,0 +1,557 @@
+package aseprite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func encodeAndRead(t *testing.T, doc *Document) (*Aseprite, []byte) {
+	var b bytes.Buffer
+	require.NoError(t, Encode(&b, doc))
+	spr, err := Read(bytes.NewReader(b.Bytes()))
+	require.NoError(t, err)
+	return spr, b.Bytes()
+}
+
+// requireFrame checks that frame i of spr shows the cel images over a transparent canvas.
+func requireFrame(t *testing.T, spr *Aseprite, i int, cels ...image.Image) {
+	want := image.NewNRGBA(image.Rectangle{Max: spr.Frames[i].Size})
+	for _, img := range cels {
+		for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+			for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+				want.Set(x, y, img.At(x, y))
+			}
+		}
+	}
+
+	got := spriteFrame(spr, i)
+	for j := range want.Pix {
+		require.True(t, got.Pix[j] == want.Pix[j], "pixel", i, j/4%want.Rect.Dx(), j/4/want.Rect.Dx())
+	}
+}
+
+func TestEncodeRGBA(t *testing.T) {
+	cel := func(frame int) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(1, 1, 5, 4))
+		for y := 1; y < 4; y++ {
+			for x := 1; x < 5; x++ {
+				img.SetNRGBA(x, y, color.NRGBA{byte(x * 50), byte(y * 60), byte(frame * 100), 255})
+			}
+		}
+		return img
+	}
+
+	body := [2]*image.NRGBA{cel(0), cel(1)}
+
+	doc := Document{
+		Width:  8,
+		Height: 6,
+		Layers: []Layer{
+			{Name: "group", Parent: -1, Group: true, Visible: true, Opacity: 255},
+			{Name: "body", Parent: 0, Visible: true, Opacity: 255, Data: []byte("layer"), Color: color.NRGBA{255, 0, 0, 255}},
+			{Name: "hidden", Parent: -1, Opacity: 255},
+			{Name: "multiply", Parent: -1, Visible: true, Opacity: 128, BlendMode: BlendMultiply},
+		},
+		Frames: []DocumentFrame{
+			{Duration: 100 * time.Millisecond, Cels: []Cel{
+				{Layer: 1, Image: body[0], Opacity: 255, Data: []byte("cel")},
+				{Layer: 2, Image: cel(2), Opacity: 255},
+			}},
+			{Duration: 150 * time.Millisecond, Cels: []Cel{{Layer: 1, Image: body[1], Opacity: 255}}},
+			{Duration: 200 * time.Millisecond, Cels: []Cel{{Layer: 1, Image: body[0], Opacity: 255}}},
+		},
+		Tags: []Tag{
+			{Name: "walk", Lo: 0, Hi: 2, Repeat: 2, LoopDirection: PingPong, Color: color.NRGBA{10, 20, 30, 255}},
+			{Name: "idle", Lo: 1, Hi: 1, Color: color.NRGBA{0, 0, 0, 255}},
+		},
+		Slices: []Slice{
+			{Name: "hit", Frame: 0, Bounds: image.Rect(1, 2, 4, 5), Center: image.Rect(1, 1, 2, 2), Pivot: image.Pt(1, 2), Data: []byte("slice"), Color: color.NRGBA{0, 0, 255, 255}},
+			{Name: "hit", Frame: 2, Bounds: image.Rect(-1, 0, 3, 3), Data: []byte("slice"), Color: color.NRGBA{0, 0, 255, 255}},
+			{Name: "feet", Frame: 0, Bounds: image.Rect(0, 5, 8, 6)},
+		},
+	}
+
+	spr, raw := encodeAndRead(t, &doc)
+
+	require.True(t, len(spr.Frames) == 3, "frames", len(spr.Frames))
+	for i, fr := range doc.Frames {
+		require.True(t, spr.Frames[i].Duration == fr.Duration, "duration", i)
+		require.True(t, spr.Frames[i].Size == image.Pt(8, 6), "size", i)
+	}
+
+	requireFrame(t, spr, 0, body[0])
+	requireFrame(t, spr, 1, body[1])
+	requireFrame(t, spr, 2, body[0])
+	require.True(t, len(spr.Frames[0].Data) == 1 && string(spr.Frames[0].Data[0]) == "cel", "cel data")
+
+	require.True(t, len(spr.Layers) == len(doc.Layers), "layers")
+	for i, l := range doc.Layers {
+		got := spr.Layers[i]
+		require.True(t, got.Name == l.Name && got.Parent == l.Parent && got.Group == l.Group, "layer", i, got)
+		require.True(t, got.Visible == l.Visible && got.Opacity == l.Opacity && got.BlendMode == l.BlendMode, "layer", i, got)
+		require.True(t, string(got.Data) == string(l.Data) && got.Color == l.Color, "layer user data", i, got)
+	}
+
+	require.True(t, len(spr.Tags) == len(doc.Tags), "tags")
+	for i, tag := range doc.Tags {
+		require.True(t, spr.Tags[i] == tag, "tag", i, spr.Tags[i])
+	}
+
+	require.True(t, len(spr.Slices) == len(doc.Slices), "slices", len(spr.Slices))
+	for i, s := range doc.Slices {
+		got := spr.Slices[i]
+		require.True(t, got.Name == s.Name && got.Frame == s.Frame && got.Bounds == s.Bounds, "slice", i, got)
+		require.True(t, got.Center == s.Center && got.Pivot == s.Pivot, "slice", i, got)
+		require.True(t, string(got.Data) == string(s.Data) && got.Color == s.Color, "slice user data", i, got)
+	}
+
+	// the cel of the last frame links to the first frame
+	var f file
+	_, err := f.ReadFrom(bytes.NewReader(raw))
+	require.NoError(t, err)
+	for _, ch := range f.frames[2].chunks {
+		if ch.typ == 0x2005 {
+			require.True(t, celType(ch.raw) == 1, "linked cel")
+		}
+	}
+}
+
+func TestEncodeIndexed(t *testing.T) {
+	palette := color.Palette{
+		color.Transparent,
+		color.NRGBA{255, 0, 0, 255},
+		color.NRGBA{0, 255, 0, 255},
+		color.NRGBA{0, 0, 255, 255},
+	}
+
+	paletted := image.NewPaletted(image.Rect(0, 0, 3, 3), palette)
+	for i := range paletted.Pix {
+		paletted.Pix[i] = uint8(i % 4)
+	}
+
+	// other images are mapped to the palette
+	nrgba := image.NewNRGBA(image.Rect(2, 2, 4, 4))
+	nrgba.SetNRGBA(2, 2, color.NRGBA{250, 10, 0, 255})
+	nrgba.SetNRGBA(3, 3, color.NRGBA{0, 0, 200, 255})
+
+	doc := Document{
+		Width:     4,
+		Height:    4,
+		ColorMode: ColorIndexed,
+		Palette:   palette,
+		Layers: []Layer{
+			{Name: "bottom", Parent: -1, Visible: true, Opacity: 255},
+			{Name: "top", Parent: -1, Visible: true, Opacity: 255},
+		},
+		Frames: []DocumentFrame{
+			{Duration: 100 * time.Millisecond, Cels: []Cel{{Layer: 0, Image: paletted, Opacity: 255}}},
+			{Duration: 100 * time.Millisecond, Cels: []Cel{{Layer: 1, Image: nrgba, Opacity: 255}}},
+		},
+	}
+
+	spr, _ := encodeAndRead(t, &doc)
+
+	atlas, ok := spr.Image.(*image.Paletted)
+	require.True(t, ok, "paletted atlas")
+	require.True(t, len(atlas.Palette) == len(palette), "palette size")
+	for i, c := range palette {
+		require.True(t, color.NRGBAModel.Convert(atlas.Palette[i]) == color.NRGBAModel.Convert(c), "palette", i)
+	}
+
+	requireFrame(t, spr, 0, paletted)
+
+	want := image.NewNRGBA(nrgba.Rect)
+	want.SetNRGBA(2, 2, color.NRGBA{255, 0, 0, 255})
+	want.SetNRGBA(3, 3, color.NRGBA{0, 0, 255, 255})
+	requireFrame(t, spr, 1, want)
+}
+
+func TestEncodeIndexedOpaque(t *testing.T) {
+	// opaque black is closer to the transparent color than to red
+	// but must not become transparent
+	palette := color.Palette{color.Transparent, color.White, color.NRGBA{255, 0, 0, 255}}
+
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	img.SetNRGBA(1, 0, color.NRGBA{250, 250, 250, 255})
+
+	doc := Document{ColorMode: ColorIndexed, Palette: palette}
+	pix := doc.celPixels(img)
+	require.True(t, pix[0] == 2 && pix[1] == 1, "pixels", pix)
+}
+
+func TestEncodeGrayscale(t *testing.T) {
+	gray := NewGrayAlpha(image.Rect(1, 0, 3, 2))
+	for i := 0; i < len(gray.Pix); i += 2 {
+		gray.Pix[i], gray.Pix[i+1] = uint8(i*30), uint8(255-i*20)
+	}
+
+	doc := Document{
+		Width:     3,
+		Height:    2,
+		ColorMode: ColorGrayscale,
+		Layers:    []Layer{{Name: "layer", Parent: -1, Visible: true, Opacity: 255}},
+		Frames: []DocumentFrame{
+			{Duration: 100 * time.Millisecond, Cels: []Cel{{Layer: 0, Image: gray, Opacity: 255}}},
+		},
+	}
+
+	spr, _ := encodeAndRead(t, &doc)
+	_, ok := spr.Image.(*GrayAlpha)
+	require.True(t, ok, "grayscale atlas")
+	requireFrame(t, spr, 0, gray)
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	valid := func() Document {
+		return Document{
+			Width:  2,
+			Height: 2,
+			Layers: []Layer{
+				{Name: "group", Parent: -1, Group: true},
+				{Name: "layer", Parent: 0},
+			},
+			Frames: []DocumentFrame{{Cels: []Cel{{Layer: 1, Image: image.NewNRGBA(image.Rect(0, 0, 2, 2))}}}},
+		}
+	}
+
+	doc := valid()
+	require.NoError(t, Encode(io.Discard, &doc))
+
+	for _, tt := range []struct {
+		Name   string
+		Modify func(doc *Document)
+	}{
+		{"size", func(doc *Document) { doc.Width = 0 }},
+		{"no_frames", func(doc *Document) { doc.Frames = nil }},
+		{"no_palette", func(doc *Document) { doc.ColorMode = ColorIndexed }},
+		{"transparent", func(doc *Document) {
+			doc.ColorMode, doc.Palette, doc.Transparent = ColorIndexed, color.Palette{color.Black}, 1
+		}},
+		{"parent_not_group", func(doc *Document) { doc.Layers[0].Group = false }},
+		{"parent_after_layer", func(doc *Document) { doc.Layers[0].Parent = 1 }},
+		{"cel_group_layer", func(doc *Document) { doc.Frames[0].Cels[0].Layer = 0 }},
+		{"cel_layer_range", func(doc *Document) { doc.Frames[0].Cels[0].Layer = 2 }},
+		{"duplicate_cel", func(doc *Document) { doc.Frames[0].Cels = append(doc.Frames[0].Cels, doc.Frames[0].Cels[0]) }},
+		{"tag_range", func(doc *Document) { doc.Tags = []Tag{{Lo: 0, Hi: 1}} }},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			doc := valid()
+			tt.Modify(&doc)
+			require.True(t, Encode(io.Discard, &doc) != nil, "expected error")
+		})
+	}
+}
+
+func TestEncodeUnmodified(t *testing.T) {
+	for _, name := range []string{"blendtest", "index_error", "slime_grayscale", "slime_paletted"} {
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile("./testfiles/" + name + ".aseprite")
+			require.NoError(t, err)
+
+			doc, err := ReadDocument(bytes.NewReader(raw))
+			require.NoError(t, err)
+
+			var b bytes.Buffer
+			require.NoError(t, Encode(&b, doc))
+			require.True(t, bytes.Equal(b.Bytes(), raw), "file changed")
+		})
+	}
+}
+
+// readChunks returns the chunks of every frame of an Aseprite file.
+func readChunks(t *testing.T, raw []byte) [][]chunk {
+	var f file
+	_, err := f.ReadFrom(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	chunks := make([][]chunk, len(f.frames))
+	for i, fr := range f.frames {
+		chunks[i] = fr.chunks
+	}
+	return chunks
+}
+
+// requireSameChunks checks that the chunks of two files are equal,
+// except for the chunks of the given types.
+func requireSameChunks(t *testing.T, a, b []byte, except ...int) {
+	ca, cb := readChunks(t, a), readChunks(t, b)
+	require.True(t, len(ca) == len(cb), "frames")
+
+	skip := func(chunks []chunk) []chunk {
+		var kept []chunk
+	next:
+		for _, ch := range chunks {
+			for _, typ := range except {
+				if ch.typ == typ {
+					continue next
+				}
+			}
+			kept = append(kept, ch)
+		}
+		return kept
+	}
+
+	for i := range ca {
+		fa, fb := skip(ca[i]), skip(cb[i])
+		require.True(t, len(fa) == len(fb), "chunks", i)
+		for j := range fa {
+			require.True(t, fa[j].typ == fb[j].typ && bytes.Equal(fa[j].raw, fb[j].raw), "chunk", i, j)
+		}
+	}
+}
+
+func TestEncodeModified(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/slime_paletted.aseprite")
+	require.NoError(t, err)
+
+	t.Run("tags", func(t *testing.T) {
+		doc, err := ReadDocument(bytes.NewReader(raw))
+		require.NoError(t, err)
+		doc.Tags[0].Name = "Jump"
+
+		var b bytes.Buffer
+		require.NoError(t, Encode(&b, doc))
+		requireSameChunks(t, raw, b.Bytes(), 0x2018, 0x2020)
+
+		spr, err := Read(bytes.NewReader(b.Bytes()))
+		require.NoError(t, err)
+		require.True(t, spr.Tags[0].Name == "Jump", "tag name", spr.Tags[0].Name)
+		require.True(t, len(spr.Tags) == len(doc.Tags), "tags")
+	})
+
+	t.Run("layers", func(t *testing.T) {
+		doc, err := ReadDocument(bytes.NewReader(raw))
+		require.NoError(t, err)
+		doc.Layers[0].Visible = true
+
+		var b bytes.Buffer
+		require.NoError(t, Encode(&b, doc))
+		requireSameChunks(t, raw, b.Bytes(), 0x2004)
+
+		spr, err := Read(bytes.NewReader(b.Bytes()))
+		require.NoError(t, err)
+		for i, l := range spr.Layers {
+			require.True(t, l.Name == doc.Layers[i].Name && l.Visible, "layer", i, l)
+		}
+	})
+
+	t.Run("cels", func(t *testing.T) {
+		doc, err := ReadDocument(bytes.NewReader(raw))
+		require.NoError(t, err)
+
+		want, err := Read(bytes.NewReader(raw))
+		require.NoError(t, err)
+
+		// clear the first cel of the last visible layer
+		var layer int
+		for i, l := range doc.Layers {
+			if l.Visible {
+				layer = i
+			}
+		}
+		cel, ok := frameCel(doc.Frames[0], layer)
+		require.True(t, ok, "cel")
+		img := cel.Image.(*image.Paletted)
+		for i := range img.Pix {
+			img.Pix[i] = doc.Transparent
+		}
+
+		var b bytes.Buffer
+		require.NoError(t, Encode(&b, doc))
+
+		spr, err := Read(bytes.NewReader(b.Bytes()))
+		require.NoError(t, err)
+
+		// only the frames that show the cel have changed
+		nchanged := 0
+		for i := range doc.Frames {
+			c, ok := frameCel(doc.Frames[i], layer)
+			changed := ok && c.Image == cel.Image
+			got, orig := spriteFrame(spr, i), spriteFrame(want, i)
+			require.True(t, bytes.Equal(got.Pix, orig.Pix) != changed, "frame", i)
+			if changed {
+				nchanged++
+			}
+		}
+		require.True(t, nchanged > 0, "no frames changed")
+
+		ca, cb := readChunks(t, raw), readChunks(t, b.Bytes())
+		for i := range ca {
+			require.True(t, len(ca[i]) == len(cb[i]), "chunks", i)
+			for j := range ca[i] {
+				same := bytes.Equal(ca[i][j].raw, cb[i][j].raw)
+				if ca[i][j].typ == 0x2005 && int(binary.LittleEndian.Uint16(ca[i][j].raw)) == layer {
+					continue
+				}
+				require.True(t, same, "chunk", i, j)
+			}
+		}
+	})
+}
+
+// encodeWithChunk encodes doc with an extra chunk at the end of every frame.
+func encodeWithChunk(t *testing.T, doc *Document, extra func(frame int) chunk) []byte {
+	e := newEncoder(doc)
+	raw := e.header()
+	for i := range doc.Frames {
+		chunks, err := e.frameChunks(i)
+		require.NoError(t, err)
+		raw = appendFrame(raw, doc.Frames[i].Duration, append(chunks, extra(i)))
+	}
+	binary.LittleEndian.PutUint32(raw, uint32(len(raw)))
+	return raw
+}
+
+func TestEncodeUnknownChunks(t *testing.T) {
+	doc := Document{
+		Width:  2,
+		Height: 2,
+		Layers: []Layer{{Name: "layer", Parent: -1, Visible: true, Opacity: 255}},
+		Frames: []DocumentFrame{
+			{Duration: 100 * time.Millisecond, Cels: []Cel{{Layer: 0, Image: image.NewNRGBA(image.Rect(0, 0, 2, 2)), Opacity: 255}}},
+			{Duration: 100 * time.Millisecond},
+		},
+	}
+
+	// write a file with unknown chunks in both frames
+	raw := encodeWithChunk(t, &doc, func(int) chunk {
+		return chunk{0x7777, []byte("custom")}
+	})
+
+	read, err := ReadDocument(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	// add a layer, a cel and a frame
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.Pix[3] = 255
+	read.Layers = append(read.Layers, Layer{Name: "new", Parent: -1, Visible: true, Opacity: 255})
+	read.Frames[1].Cels = append(read.Frames[1].Cels, Cel{Layer: 1, Image: img, Opacity: 255})
+	read.Frames = append(read.Frames, DocumentFrame{Duration: 50 * time.Millisecond})
+
+	var b bytes.Buffer
+	require.NoError(t, Encode(&b, read))
+
+	chunks := readChunks(t, b.Bytes())
+	require.True(t, len(chunks) == 3, "frames")
+	for i := 0; i < 2; i++ {
+		found := false
+		for _, ch := range chunks[i] {
+			found = found || ch.typ == 0x7777 && string(ch.raw) == "custom"
+		}
+		require.True(t, found, "unknown chunk", i)
+	}
+
+	spr, err := Read(bytes.NewReader(b.Bytes()))
+	require.NoError(t, err)
+	require.True(t, len(spr.Layers) == 2 && spr.Layers[1].Name == "new", "layers")
+	require.True(t, spr.Frames[2].Duration == 50*time.Millisecond, "duration")
+	requireFrame(t, spr, 1, img)
+}
+
+func TestEncodeSliceIdentity(t *testing.T) {
+	doc := Document{
+		Width:  4,
+		Height: 4,
+		Layers: []Layer{{Name: "layer", Parent: -1, Visible: true, Opacity: 255}},
+		Frames: []DocumentFrame{{Duration: 100 * time.Millisecond}, {Duration: 100 * time.Millisecond}},
+		Slices: []Slice{
+			// two slices with the same name
+			{Name: "hit", ID: 0, Frame: 0, Bounds: image.Rect(0, 0, 1, 1)},
+			{Name: "hit", ID: 1, Frame: 1, Bounds: image.Rect(1, 1, 2, 2)},
+			// a pivot at the origin
+			{Name: "feet", ID: 2, Frame: 0, Bounds: image.Rect(0, 0, 4, 4), HasPivot: true},
+		},
+	}
+
+	spr, _ := encodeAndRead(t, &doc)
+
+	require.True(t, len(spr.Slices) == 3, "slices", len(spr.Slices))
+	for i, s := range spr.Slices {
+		require.True(t, s.ID == i, "id", i, s.ID)
+	}
+	require.True(t, spr.Slices[2].HasPivot && !spr.Slices[2].HasCenter, "flags", spr.Slices[2])
+}
+
+func TestDocumentCelRaw(t *testing.T) {
+	// an uncompressed indexed cel with an index outside of the palette
+	raw := make([]byte, 22)
+	raw[6] = 255
+	binary.LittleEndian.PutUint16(raw[16:], 2)
+	binary.LittleEndian.PutUint16(raw[18:], 1)
+	raw[20], raw[21] = 1, 9
+	orig := cloneBytes(raw)
+
+	f := file{layers: []layer{{}}}
+	doc := Document{ColorMode: ColorIndexed, Palette: color.Palette{color.Transparent, color.Black}}
+	s, err := f.documentCel(&doc, nil, 0, raw)
+	require.NoError(t, err)
+
+	img := s.cel.Image.(*image.Paletted)
+	require.True(t, img.Pix[0] == 1 && img.Pix[1] == doc.Transparent, "pixels", img.Pix)
+	require.True(t, bytes.Equal(raw, orig), "chunk changed")
+}
+
+// layerFlags returns the flags of the layer chunks of an Aseprite file.
+func layerFlags(t *testing.T, raw []byte) []uint16 {
+	it, err := Chunks(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	var flags []uint16
+	for it.Next() {
+		if ch := it.Chunk(); ch.Type == 0x2004 {
+			flags = append(flags, binary.LittleEndian.Uint16(ch.Data))
+		}
+	}
+	return flags
+}
+
+func TestEncodeLayerFlags(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/blendtest.aseprite")
+	require.NoError(t, err)
+
+	doc, err := ReadDocument(bytes.NewReader(raw))
+	require.NoError(t, err)
+	l := doc.Layers[0]
+	require.True(t, l.Background && l.LockMovement && !l.Locked, "background layer", l)
+	doc.Layers[0].Name = "renamed"
+
+	var b bytes.Buffer
+	require.NoError(t, Encode(&b, doc))
+
+	want, got := layerFlags(t, raw), layerFlags(t, b.Bytes())
+	require.True(t, len(got) == len(want), "layers", got)
+	for i := range want {
+		require.True(t, got[i] == want[i], "flags", i, want, got)
+	}
+}
+
+func TestEncodeNewLayerFlags(t *testing.T) {
+	doc := Document{
+		Width:  4,
+		Height: 4,
+		Layers: []Layer{
+			{Name: "background", Parent: -1, Visible: true, Background: true, LockMovement: true, Opacity: 255},
+			{Name: "group", Parent: -1, Group: true, Collapsed: true, Locked: true, Opacity: 255},
+			{Name: "child", Parent: 1, Visible: true, PreferLinked: true, Reference: true, Opacity: 255},
+		},
+		Frames: []DocumentFrame{{Duration: 100 * time.Millisecond}},
+	}
+
+	spr, raw := encodeAndRead(t, &doc)
+
+	flags := layerFlags(t, raw)
+	require.True(t, len(flags) == 3 && flags[0] == 15 && flags[1] == 32 && flags[2] == 83, "flags", flags)
+	for i, l := range spr.Layers {
+		require.True(t, reflect.DeepEqual(l, doc.Layers[i]), "layer", i, l)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"image/color"
 	"image/draw"
 	"io"
-	"math"
 	"time"
 
 	"github.com/askeladdk/aseprite/internal/blend"
@@ -16,13 +15,28 @@ import (
 
 var errInvalidMagic = errors.New("invalid magic number")
 
+var errNoFrames = errors.New("aseprite: file has no frames")
+
 type cel struct {
-	image image.Image
-	mask  image.Uniform
-	data  []byte
+	image   image.Image
+	opacity byte
+	data    []byte
 }
 
 func makeCelImage8(f *file, bounds image.Rectangle, opacity byte, pix []byte) cel {
+	// Correction to avoid palette index errors if a color has been deleted from the Aseprite palette.
+	// Uncompressed pixels are the chunk data, so the correction is made in a copy.
+	fixed := false
+	for i := range pix {
+		if int(pix[i]) >= len(f.palette) {
+			if !fixed {
+				pix, fixed = cloneBytes(pix), true
+			}
+			// Assign a transparent index if the index is outside the palette range.
+			pix[i] = f.transparent
+		}
+	}
+
 	img := image.Paletted{
 		Pix:     pix,
 		Stride:  bounds.Dx(),
@@ -30,9 +44,7 @@ func makeCelImage8(f *file, bounds image.Rectangle, opacity byte, pix []byte) ce
 		Palette: f.palette,
 	}
 
-	mask := image.Uniform{color.Alpha{opacity}}
-
-	return cel{&img, mask, nil}
+	return cel{&img, opacity, nil}
 }
 
 func makeCelImage16(f *file, bounds image.Rectangle, opacity byte, pix []byte) cel {
@@ -46,18 +58,15 @@ func makeCelImage16(f *file, bounds image.Rectangle, opacity byte, pix []byte) c
 			grayValue := pix[i]    // 8-bit grey
 			alphaValue := pix[i+1] // 8-bit alpha
 
-			finalAlpha := uint16(alphaValue) * uint16(opacity) / 255
-
 			img.SetNRGBA(x, y, color.NRGBA{
 				R: grayValue,
 				G: grayValue,
 				B: grayValue,
-				A: byte(finalAlpha),
+				A: alphaValue,
 			})
 		}
 	}
-	mask := image.Uniform{color.Alpha{opacity}}
-	return cel{img, mask, nil}
+	return cel{img, opacity, nil}
 }
 
 func makeCelImage32(f *file, bounds image.Rectangle, opacity byte, pix []byte) cel {
@@ -67,16 +76,18 @@ func makeCelImage32(f *file, bounds image.Rectangle, opacity byte, pix []byte) c
 		Rect:   bounds,
 	}
 
-	mask := image.Uniform{color.Alpha{opacity}}
-
-	return cel{&img, mask, nil}
+	return cel{&img, opacity, nil}
 }
 
 type layer struct {
-	flags     uint16
-	blendMode uint16
-	opacity   byte
-	data      []byte
+	flags      uint16
+	typ        uint16
+	childLevel uint16
+	blendMode  uint16
+	opacity    byte
+	name       string
+	data       []byte
+	color      color.Color
 }
 
 func (l *layer) Parse(raw []byte) error {
@@ -84,8 +95,11 @@ func (l *layer) Parse(raw []byte) error {
 		return errors.New("tilemap layers not supported")
 	}
 	l.flags = binary.LittleEndian.Uint16(raw)
+	l.typ = binary.LittleEndian.Uint16(raw[2:])
+	l.childLevel = binary.LittleEndian.Uint16(raw[4:])
 	l.blendMode = binary.LittleEndian.Uint16(raw[10:])
 	l.opacity = raw[12]
+	l.name = parseString(raw[16:])
 	return nil
 }
 
@@ -192,7 +206,9 @@ func (f *file) ReadFrom(r io.Reader) (int64, error) {
 	for i := range f.palette {
 		f.palette[i] = color.Black
 	}
-	f.palette[f.transparent] = color.Transparent
+	if int(f.transparent) < len(f.palette) {
+		f.palette[f.transparent] = color.Transparent
+	}
 
 	fileSize := int64(binary.LittleEndian.Uint32(raw))
 	raw = make([]byte, fileSize-128)
@@ -211,64 +227,187 @@ func (f *file) ReadFrom(r io.Reader) (int64, error) {
 		f.frames = append(f.frames, fr)
 	}
 
+	if len(f.frames) == 0 {
+		return fileSize, errNoFrames
+	}
+
 	return fileSize, nil
 }
 
-func (f *file) buildAtlas() (atlas draw.Image, framesr []image.Rectangle) {
-	var atlasr image.Rectangle
-	atlasr, framesr = makeAtlasFrames(len(f.frames), f.framew, f.frameh)
+// decode decodes all cels. If the frames must be known before the atlas
+// is laid out, it also composites every frame into a separate image,
+// which are *image.NRGBA images. Otherwise it returns nil and
+// buildAtlas composites the frames when it draws them on the atlas.
+func (f *file) decode(opts *Options) ([]image.Image, error) {
+	f.initPalette()
 
-	switch f.bpp {
-	case 8:
-		atlas = image.NewPaletted(atlasr, f.palette)
-	case 16:
-		atlas = image.NewNRGBA(atlasr)
-	default:
-		atlas = image.NewRGBA(atlasr)
+	if err := f.initLayers(); err != nil {
+		return nil, err
+	}
+
+	workers := opts.parallelism()
+
+	if err := f.initCels(workers); err != nil {
+		return nil, err
+	}
+
+	if !opts.wholeFrames() {
+		return nil, nil
 	}
 
 	framebounds := image.Rect(0, 0, f.framew, f.frameh)
+	frames := make([]image.Image, len(f.frames))
+	_ = parallel(len(frames), workers, func(_, i int) error {
+		img := image.NewNRGBA(framebounds)
+		f.drawFrame(img, i)
+		frames[i] = img
+		return nil
+	})
+
+	return frames, nil
+}
 
-	dstblend := image.NewRGBA(framebounds)
-	dst := image.NewRGBA(framebounds)
+// buildAtlas draws the images of the composited frames on the atlas pages.
+// srcs are the bounds of the frame images within the frames.
+// If frames is nil, every frame is composited into a scratch buffer
+// of the worker that draws it.
+func (f *file) buildAtlas(opts *Options, frames []image.Image, srcs []image.Rectangle) (pages []image.Image, framesr []image.Rectangle, pageOf []int, err error) {
+	slots := frameSlots(opts, frames, srcs)
 
-	transparent := &image.Uniform{color.Transparent}
+	var pagesr []image.Rectangle
+	if pagesr, framesr, pageOf, err = f.atlasLayout(opts, srcs, slots); err != nil {
+		return nil, nil, nil, err
+	}
 
-	for i, fr := range f.frames {
-		draw.Draw(dst, framebounds, transparent, image.Point{}, draw.Src)
-		for layer, c := range fr.cels {
-			if c.image == nil {
-				continue
-			}
+	atlases := make([]draw.Image, len(pagesr))
+	for i, r := range pagesr {
+		switch f.bpp {
+		case 8:
+			atlases[i] = image.NewPaletted(r, f.palette)
+		case 16:
+			atlases[i] = NewGrayAlpha(r)
+		default:
+			atlases[i] = image.NewRGBA(r)
+		}
+	}
+
+	frame := func(_, i int) image.Image {
+		return frames[i]
+	}
 
-			src := c.image
-			sr := src.Bounds()
-			sp := sr.Min
-
-			// Correction to avoid palette index errors if a color has been deleted from the Aseprite palette.
-			if imgPaletted, ok := src.(*image.Paletted); ok {
-				for i := range imgPaletted.Pix {
-					if int(imgPaletted.Pix[i]) >= len(f.palette) {
-						// Assign a transparent index if the index is outside the palette range.
-						imgPaletted.Pix[i] = f.transparent
-					}
-				}
+	if frames == nil {
+		framebounds := image.Rect(0, 0, f.framew, f.frameh)
+		scratch := make([]*image.NRGBA, opts.parallelism())
+		frame = func(w, i int) image.Image {
+			if scratch[w] == nil {
+				scratch[w] = image.NewNRGBA(framebounds)
 			}
+			f.drawFrame(scratch[w], i)
+			return scratch[w]
+		}
+	}
+
+	return drawAtlas(opts, atlases, frame, srcs, slots, framesr, pageOf), framesr, pageOf, nil
+}
+
+// drawAtlas draws the first frame of every slot on the atlas pages
+// and returns the pages. frame returns the image of frame i
+// to the worker w that draws it.
+func drawAtlas(opts *Options, atlases []draw.Image, frame func(w, i int) image.Image, srcs []image.Rectangle, slots []int, framesr []image.Rectangle, pageOf []int) []image.Image {
+	var extrude int
+	if opts != nil {
+		extrude = nonNegative(opts.Extrude)
+	}
+
+	firsts := make([]int, 0, len(slots))
+	for i, s := range slots {
+		if s == len(firsts) {
+			firsts = append(firsts, i)
+		}
+	}
+
+	// Slots occupy disjoint rectangles of the atlas, including their extruded edges.
+	_ = parallel(len(firsts), opts.parallelism(), func(w, j int) error {
+		i := firsts[j]
+		drawAtlasFrame(atlases[pageOf[i]], framesr[i], frame(w, i), srcs[i].Min)
+		extrudeFrame(atlases[pageOf[i]], framesr[i], extrude)
+		return nil
+	})
+
+	pages := make([]image.Image, len(atlases))
+	for i, atlas := range atlases {
+		pages[i] = atlas
+	}
+
+	return pages
+}
 
-			if mode := f.layers[layer].blendMode; mode > 0 && int(mode) < len(blend.Modes) {
-				draw.Draw(dstblend, framebounds, transparent, image.Point{}, draw.Src)
-				blend.Blend(dstblend, sr.Sub(sp), src, sp, dst, sp, blend.Modes[mode])
-				src = dstblend
-				sp = image.Point{}
+// drawAtlasFrame copies the frame image src starting at sp to r in the atlas.
+// Paletted frames are copied to paletted atlases by index, so they must
+// have the same palette.
+func drawAtlasFrame(atlas draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
+	if dst, ok := atlas.(*image.Paletted); ok {
+		if src, ok := src.(*image.Paletted); ok {
+			for y := 0; y < r.Dy(); y++ {
+				i, j := dst.PixOffset(r.Min.X, r.Min.Y+y), src.PixOffset(sp.X, sp.Y+y)
+				copy(dst.Pix[i:i+r.Dx()], src.Pix[j:j+r.Dx()])
 			}
+			return
+		}
+	}
+
+	dst, ok := atlas.(*GrayAlpha)
+	if !ok {
+		draw.Draw(atlas, r, src, sp, draw.Src)
+		return
+	}
 
-			draw.DrawMask(dst, sr, src, sp, &c.mask, image.Point{}, draw.Over)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := src.At(x-r.Min.X+sp.X, y-r.Min.Y+sp.Y)
+			dst.SetGrayAlpha(x, y, grayAlphaModel(c).(GrayAlphaColor))
 		}
+	}
+}
+
+// extrudeFrame repeats the edge pixels of the frame at r in the atlas n times outward.
+func extrudeFrame(atlas draw.Image, r image.Rectangle, n int) {
+	if r.Empty() {
+		return
+	}
+
+	for i := 1; i <= n; i++ {
+		drawAtlasFrame(atlas, image.Rect(r.Min.X-i, r.Min.Y, r.Min.X-i+1, r.Max.Y), atlas, r.Min)
+		drawAtlasFrame(atlas, image.Rect(r.Max.X+i-1, r.Min.Y, r.Max.X+i, r.Max.Y), atlas, image.Pt(r.Max.X-1, r.Min.Y))
+	}
 
-		draw.Draw(atlas, framesr[i], dst, image.Point{}, draw.Src)
+	// The top and bottom edges include the corners.
+	r.Min.X, r.Max.X = r.Min.X-n, r.Max.X+n
+	for i := 1; i <= n; i++ {
+		drawAtlasFrame(atlas, image.Rect(r.Min.X, r.Min.Y-i, r.Max.X, r.Min.Y-i+1), atlas, r.Min)
+		drawAtlasFrame(atlas, image.Rect(r.Min.X, r.Max.Y+i-1, r.Max.X, r.Max.Y+i), atlas, image.Pt(r.Min.X, r.Max.Y-1))
 	}
+}
+
+// drawFrame composites all cels of frame i into dst.
+func (f *file) drawFrame(dst *image.NRGBA, i int) {
+	for j := range dst.Pix {
+		dst.Pix[j] = 0
+	}
+
+	for layer, c := range f.frames[i].cels {
+		if c.image == nil {
+			continue
+		}
+
+		mode := int(f.layers[layer].blendMode)
+		if mode >= len(blend.Modes) {
+			mode = 0
+		}
 
-	return
+		sr := c.image.Bounds()
+		blend.Composite(dst, sr, c.image, sr.Min, mode, c.opacity)
+	}
 }
 
 func (f *file) buildUserData() []byte {
@@ -301,12 +440,56 @@ func (f *file) buildLayerData(userdata []byte) [][]byte {
 	return ld
 }
 
-func (f *file) buildFrames(framesr []image.Rectangle, userdata []byte) ([]Frame, []byte) {
+func (f *file) buildLayers() []Layer {
+	layers := make([]Layer, len(f.layers))
+
+	// groups[n] is the last group layer at child level n
+	var groups []int
+
+	for i, l := range f.layers {
+		parent := -1
+		if n := int(l.childLevel); n > 0 && n <= len(groups) {
+			parent = groups[n-1]
+		}
+
+		layers[i] = Layer{
+			Name:         l.name,
+			Parent:       parent,
+			Group:        l.typ == 1,
+			Visible:      l.flags&1 != 0,
+			Locked:       l.flags&2 == 0,
+			LockMovement: l.flags&4 != 0,
+			Background:   l.flags&8 != 0,
+			PreferLinked: l.flags&16 != 0,
+			Collapsed:    l.flags&32 != 0,
+			Reference:    l.flags&64 != 0,
+			Opacity:      l.opacity,
+			BlendMode:    BlendMode(l.blendMode),
+			Data:         l.data,
+			Color:        l.color,
+		}
+
+		if l.typ == 1 {
+			n := int(l.childLevel)
+			if n > len(groups) {
+				n = len(groups)
+			}
+			groups = append(groups[:n], i)
+		}
+	}
+
+	return layers
+}
+
+func (f *file) buildFrames(framesr, srcs []image.Rectangle, pageOf []int, userdata []byte) ([]Frame, []byte) {
 	frames := make([]Frame, len(f.frames))
 
 	for i, fr := range f.frames {
 		frames[i].Duration = fr.dur
 		frames[i].Bounds = framesr[i]
+		frames[i].Page = pageOf[i]
+		frames[i].Offset = srcs[i].Min
+		frames[i].Size = image.Pt(f.framew, f.frameh)
 		frames[i].Data = make([][]byte, 0, len(fr.cels))
 		for _, c := range fr.cels {
 			if nd := len(c.data); nd > 0 {
@@ -319,30 +502,3 @@ func (f *file) buildFrames(framesr []image.Rectangle, userdata []byte) ([]Frame,
 
 	return frames, userdata
 }
-
-func makeAtlasFrames(nframes, framew, frameh int) (atlasr image.Rectangle, framesr []image.Rectangle) {
-	fw, fh := factorPowerOfTwo(nframes)
-	if framew > frameh {
-		fw, fh = fh, fw
-	}
-
-	atlasr = image.Rect(0, 0, fw*framew, fh*frameh)
-
-	for i := 0; i < nframes; i++ {
-		x, y := i%fw, i/fw
-		framesr = append(framesr, image.Rectangle{
-			Min: image.Pt(x*framew, y*frameh),
-			Max: image.Pt((x+1)*framew, (y+1)*frameh),
-		})
-	}
-
-	return
-}
-
-// factorPowerOfTwo computes n=a*b, where a, b are powers of two and a >= b.
-func factorPowerOfTwo(n int) (a, b int) {
-	x := int(math.Ceil(math.Log2(float64(n))))
-	a = 1 << (x - x/2)
-	b = 1 << (x / 2)
-	return
-}
@@ -0,0 +1,232 @@
+package aseprite
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+// testLayer describes a layer of a sprite generated by makeTestFile.
+type testLayer struct {
+	Mode    uint16
+	Opacity byte
+	Pixel   func(frame, x, y int) color.NRGBA
+}
+
+// gradientLayers returns layers with the given blend modes,
+// filled with a gradient that differs per frame and layer.
+func gradientLayers(modes ...uint16) []testLayer {
+	layers := make([]testLayer, len(modes))
+	for i, mode := range modes {
+		i := i
+		layers[i] = testLayer{
+			Mode:    mode,
+			Opacity: 255,
+			Pixel: func(frame, x, y int) color.NRGBA {
+				return color.NRGBA{
+					R: byte(x + frame),
+					G: byte(y + i*32),
+					B: byte(x*y + frame),
+					A: byte(128 + x + y + i),
+				}
+			},
+		}
+	}
+	return layers
+}
+
+// makeTestFile generates an RGBA sprite with nframes frames of w x h pixels.
+// Each frame has one cel per layer that covers the entire frame.
+func makeTestFile(nframes, w, h int, layers []testLayer) []byte {
+	var b bytes.Buffer
+
+	chunk := func(typ uint16, data []byte) []byte {
+		var c []byte
+		c = binary.LittleEndian.AppendUint32(c, uint32(6+len(data)))
+		c = binary.LittleEndian.AppendUint16(c, typ)
+		return append(c, data...)
+	}
+
+	var hdr [128]byte
+	binary.LittleEndian.PutUint16(hdr[4:], 0xA5E0)
+	binary.LittleEndian.PutUint16(hdr[6:], uint16(nframes))
+	binary.LittleEndian.PutUint16(hdr[8:], uint16(w))
+	binary.LittleEndian.PutUint16(hdr[10:], uint16(h))
+	binary.LittleEndian.PutUint16(hdr[12:], 32)
+	binary.LittleEndian.PutUint32(hdr[14:], 1)
+	binary.LittleEndian.PutUint16(hdr[32:], 256)
+	hdr[34], hdr[35] = 1, 1
+	b.Write(hdr[:])
+
+	for i := 0; i < nframes; i++ {
+		var chunks [][]byte
+
+		if i == 0 {
+			for _, layer := range layers {
+				var l [18]byte
+				binary.LittleEndian.PutUint16(l[0:], 1) // visible
+				binary.LittleEndian.PutUint16(l[10:], layer.Mode)
+				l[12] = layer.Opacity
+				chunks = append(chunks, chunk(0x2004, l[:]))
+			}
+		}
+
+		for layer := range layers {
+			pix := make([]byte, 4*w*h)
+			for j := 0; j < len(pix); j += 4 {
+				c := layers[layer].Pixel(i, (j/4)%w, (j/4)/w)
+				pix[j+0], pix[j+1], pix[j+2], pix[j+3] = c.R, c.G, c.B, c.A
+			}
+
+			var z bytes.Buffer
+			zw := zlib.NewWriter(&z)
+			_, _ = zw.Write(pix)
+			_ = zw.Close()
+
+			var c [20]byte
+			binary.LittleEndian.PutUint16(c[0:], uint16(layer))
+			c[6] = 255
+			binary.LittleEndian.PutUint16(c[7:], 2) // compressed image
+			binary.LittleEndian.PutUint16(c[16:], uint16(w))
+			binary.LittleEndian.PutUint16(c[18:], uint16(h))
+			chunks = append(chunks, chunk(0x2005, append(c[:], z.Bytes()...)))
+		}
+
+		var frame [16]byte
+		size := len(frame)
+		for _, c := range chunks {
+			size += len(c)
+		}
+		binary.LittleEndian.PutUint32(frame[0:], uint32(size))
+		binary.LittleEndian.PutUint16(frame[4:], 0xF1FA)
+		binary.LittleEndian.PutUint16(frame[8:], 100)
+		binary.LittleEndian.PutUint32(frame[12:], uint32(len(chunks)))
+		b.Write(frame[:])
+		for _, c := range chunks {
+			b.Write(c)
+		}
+	}
+
+	raw := b.Bytes()
+	binary.LittleEndian.PutUint32(raw, uint32(len(raw)))
+	return raw
+}
+
+func TestParallelism(t *testing.T) {
+	raw := makeTestFile(13, 48, 32, gradientLayers(0, 1, 3, 12, 16))
+
+	serial, err := ReadWithOptions(bytes.NewReader(raw), &Options{Parallelism: 1})
+	require.NoError(t, err)
+
+	for _, n := range []int{2, 3, 8, 64} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			spr, err := ReadWithOptions(bytes.NewReader(raw), &Options{Parallelism: n})
+			require.NoError(t, err)
+			require.True(t, spr.Bounds() == serial.Bounds(), "bounds")
+			a, b := spr.Image.(*image.RGBA), serial.Image.(*image.RGBA)
+			require.True(t, bytes.Equal(a.Pix, b.Pix), "pixels differ")
+		})
+	}
+}
+
+func TestMakeCelImage8(t *testing.T) {
+	f := file{palette: color.Palette{color.Transparent, color.Black}}
+	pix := []byte{1, 9}
+
+	c := makeCelImage8(&f, image.Rect(0, 0, 2, 1), 255, pix)
+	img := c.image.(*image.Paletted)
+	require.True(t, img.Pix[0] == 1 && img.Pix[1] == f.transparent, "pixels", img.Pix)
+	require.True(t, pix[1] == 9, "chunk data changed")
+}
+
+func TestDecodeFrames(t *testing.T) {
+	raw := makeTestFile(4, 16, 16, gradientLayers(0, 1))
+
+	// frames are only kept in separate images when the layout needs them
+	for _, tt := range []struct {
+		Opts   *Options
+		Frames bool
+	}{
+		{nil, false},
+		{&Options{Parallelism: 4}, false},
+		{&Options{Trim: true}, true},
+		{&Options{Dedupe: true}, true},
+	} {
+		var f file
+		_, err := f.ReadFrom(bytes.NewReader(raw))
+		require.NoError(t, err)
+
+		frames, err := f.decode(tt.Opts)
+		require.NoError(t, err)
+		require.True(t, (frames != nil) == tt.Frames, "frames", tt.Opts)
+	}
+}
+
+func TestLayerOpacity(t *testing.T) {
+	uniform := func(c color.NRGBA) func(int, int, int) color.NRGBA {
+		return func(int, int, int) color.NRGBA { return c }
+	}
+
+	for _, tt := range []struct {
+		Name   string
+		Layers []testLayer
+		Want   color.NRGBA
+	}{
+		{
+			Name: "normal",
+			Layers: []testLayer{
+				{0, 255, uniform(color.NRGBA{0, 0, 255, 255})},
+				{0, 128, uniform(color.NRGBA{255, 0, 0, 128})},
+			},
+			Want: color.NRGBA{64, 0, 191, 255},
+		},
+		{
+			Name: "multiply",
+			Layers: []testLayer{
+				{0, 255, uniform(color.NRGBA{200, 200, 200, 128})},
+				{1, 255, uniform(color.NRGBA{100, 100, 100, 255})},
+			},
+			Want: color.NRGBA{83, 83, 83, 255},
+		},
+		{
+			Name: "multiply over transparent",
+			Layers: []testLayer{
+				{0, 255, uniform(color.NRGBA{})},
+				{1, 128, uniform(color.NRGBA{100, 100, 100, 255})},
+			},
+			Want: color.NRGBA{100, 100, 100, 128},
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			spr, err := Read(bytes.NewReader(makeTestFile(1, 1, 1, tt.Layers)))
+			require.NoError(t, err)
+			// the atlas of an RGBA sprite stores premultiplied colors
+			want := color.RGBAModel.Convert(tt.Want)
+			got := spr.At(0, 0)
+			require.True(t, got == want, "got", got, "want", want)
+		})
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	raw := makeTestFile(64, 128, 128, gradientLayers(0, 1, 2, 16))
+
+	for _, n := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("parallelism=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(raw)))
+			opts := Options{Parallelism: n}
+			for i := 0; i < b.N; i++ {
+				if _, err := ReadWithOptions(bytes.NewReader(raw), &opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package aseprite
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"sort"
+	"time"
+)
+
+// GIF returns the animation of a tag as an animated GIF.
+// If tag is nil, the animation plays all frames forward and loops forever.
+// The frames are played in the order of Player, including nested tags.
+// Animations that repeat forever loop over the frames that they repeat,
+// since a GIF cannot play some frames only once before it loops.
+// Frame delays are rounded to centiseconds such that the rounding errors
+// do not accumulate over the animation.
+// Indexed sprites keep their palette and add a transparent color if it has none.
+// Other sprites and indexed sprites with a full opaque palette
+// are quantized to 255 colors and a transparent color.
+// Pixels that are less than half opaque become transparent.
+func GIF(spr *Aseprite, tag *Tag) (*gif.GIF, error) {
+	seq, loopCount, err := animation(spr, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([]*image.NRGBA, len(spr.Frames))
+	for _, i := range seq {
+		if frames[i] == nil {
+			frames[i] = spriteFrame(spr, i)
+		}
+	}
+
+	var palette color.Palette
+	var transparent uint8
+	var ok bool
+
+	if img, isPaletted := spr.Image.(*image.Paletted); isPaletted {
+		palette, transparent, ok = withTransparent(img.Palette)
+	}
+	if !ok {
+		palette, transparent = quantize(frames, 256)
+	}
+
+	size := spr.Frames[seq[0]].Size
+
+	g := gif.GIF{
+		Image:     make([]*image.Paletted, len(seq)),
+		Delay:     make([]int, len(seq)),
+		Disposal:  make([]byte, len(seq)),
+		LoopCount: loopCount,
+		Config: image.Config{
+			ColorModel: palette,
+			Width:      size.X,
+			Height:     size.Y,
+		},
+		BackgroundIndex: transparent,
+	}
+
+	images := make(map[int]*image.Paletted)
+	var elapsed time.Duration
+
+	for j, i := range seq {
+		img, ok := images[i]
+		if !ok {
+			img = palettedFrame(frames[i], palette, transparent)
+			images[i] = img
+		}
+
+		// round the end time of the frame to prevent drift
+		start := centiseconds(elapsed)
+		elapsed += spr.Frames[i].Duration
+		g.Image[j] = img
+		g.Delay[j] = centiseconds(elapsed) - start
+		g.Disposal[j] = gif.DisposalBackground
+	}
+
+	return &g, nil
+}
+
+// animation returns the sequence of frames that a tag plays and
+// the number of times the sequence loops as defined by gif.GIF.LoopCount.
+// If tag is nil, all frames are played forward forever.
+func animation(spr *Aseprite, tag *Tag) (seq []int, loopCount int, err error) {
+	t, err := spriteTag(spr, tag)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	intro, cycle := spr.tagLoop(t, tag != nil)
+	if len(cycle) > 0 {
+		return period(cycle), 0, nil
+	}
+
+	seq = period(intro)
+	if loopCount = len(intro)/len(seq) - 1; loopCount == 0 {
+		loopCount = -1
+	}
+	return seq, loopCount, nil
+}
+
+// spriteTag returns a copy of tag after checking that its frames are in the sprite.
+// If tag is nil, it returns a tag that plays all frames forward forever.
+func spriteTag(spr *Aseprite, tag *Tag) (Tag, error) {
+	if len(spr.Frames) == 0 {
+		return Tag{}, errors.New("aseprite: sprite has no frames")
+	}
+
+	t := Tag{Hi: uint16(len(spr.Frames) - 1)}
+	if tag != nil {
+		t = *tag
+	}
+
+	if int(t.Hi) >= len(spr.Frames) || t.Lo > t.Hi {
+		return Tag{}, errors.New("aseprite: tag frames out of range")
+	}
+
+	return t, nil
+}
+
+// centiseconds rounds d to the nearest centisecond.
+func centiseconds(d time.Duration) int {
+	return int((d + 5*time.Millisecond) / (10 * time.Millisecond))
+}
+
+// spriteFrame returns the untrimmed image of frame i.
+func spriteFrame(spr *Aseprite, i int) *image.NRGBA {
+	fr := spr.Frames[i]
+	img := image.NewNRGBA(image.Rectangle{Max: fr.Size})
+	r := fr.Bounds.Sub(fr.Bounds.Min).Add(fr.Offset)
+	draw.Draw(img, r, spr.Pages[fr.Page], fr.Bounds.Min, draw.Src)
+	return img
+}
+
+// palettedFrame converts img to the palette.
+// Pixels that are less than half opaque are set to the transparent index.
+func palettedFrame(img *image.NRGBA, p color.Palette, transparent uint8) *image.Paletted {
+	dst := image.NewPaletted(img.Bounds(), p)
+	cache := make(map[color.NRGBA]uint8)
+
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			c := img.NRGBAAt(x, y)
+			if c.A < 128 {
+				dst.Pix[dst.PixOffset(x, y)] = transparent
+				continue
+			}
+
+			c.A = 255
+			index, ok := cache[c]
+			if !ok {
+				index = nearestOpaque(p, c, transparent)
+				cache[c] = index
+			}
+			dst.Pix[dst.PixOffset(x, y)] = index
+		}
+	}
+
+	return dst
+}
+
+// nearestOpaque returns the index of the palette color that is closest to c,
+// excluding colors that are less than half opaque.
+func nearestOpaque(p color.Palette, c color.NRGBA, transparent uint8) uint8 {
+	best, bestDist := transparent, -1
+	for i, pc := range p {
+		n := color.NRGBAModel.Convert(pc).(color.NRGBA)
+		if n.A < 128 {
+			continue
+		}
+		dr, dg, db := int(n.R)-int(c.R), int(n.G)-int(c.G), int(n.B)-int(c.B)
+		if dist := dr*dr + dg*dg + db*db; bestDist < 0 || dist < bestDist {
+			best, bestDist = uint8(i), dist
+		}
+	}
+	return best
+}
+
+// colorCount is a color and the number of pixels that have it.
+type colorCount struct {
+	c [3]uint8
+	n int
+}
+
+// quantize returns a palette of at most n colors for the opaque pixels of imgs
+// and the index of the transparent color, which is the last color.
+// If there are fewer than n colors, they are all in the palette.
+func quantize(imgs []*image.NRGBA, n int) (color.Palette, uint8) {
+	counts := make(map[[3]uint8]int)
+	for _, img := range imgs {
+		if img == nil {
+			continue
+		}
+		for i := 0; i < len(img.Pix); i += 4 {
+			if img.Pix[i+3] >= 128 {
+				counts[[3]uint8{img.Pix[i], img.Pix[i+1], img.Pix[i+2]}]++
+			}
+		}
+	}
+
+	colors := make([]colorCount, 0, len(counts))
+	for c, n := range counts {
+		colors = append(colors, colorCount{c, n})
+	}
+
+	// sort for deterministic palettes
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i].c, colors[j].c
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		} else if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+
+	p := medianCut(colors, n-1)
+	return append(p, color.Transparent), uint8(len(p))
+}
+
+// medianCut reduces colors to at most n colors by repeatedly splitting
+// the box of colors with the widest channel range at its median pixel.
+func medianCut(colors []colorCount, n int) color.Palette {
+	if len(colors) == 0 {
+		return color.Palette{}
+	}
+
+	boxes := [][]colorCount{colors}
+	for len(boxes) < n {
+		// find the box with the widest range
+		best, bestRange, bestChannel := -1, 0, 0
+		for i, box := range boxes {
+			ch, rng := widestChannel(box)
+			if rng > bestRange {
+				best, bestRange, bestChannel = i, rng, ch
+			}
+		}
+
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.SliceStable(box, func(i, j int) bool {
+			return box[i].c[bestChannel] < box[j].c[bestChannel]
+		})
+
+		// split at the median pixel, keeping both halves non-empty
+		total := 0
+		for _, c := range box {
+			total += c.n
+		}
+		split, acc := 1, box[0].n
+		for split < len(box)-1 && acc < total/2 {
+			acc += box[split].n
+			split++
+		}
+
+		boxes[best] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	p := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		var r, g, b, total int
+		for _, c := range box {
+			r += int(c.c[0]) * c.n
+			g += int(c.c[1]) * c.n
+			b += int(c.c[2]) * c.n
+			total += c.n
+		}
+		p[i] = color.NRGBA{uint8((r + total/2) / total), uint8((g + total/2) / total), uint8((b + total/2) / total), 255}
+	}
+
+	return p
+}
+
+// widestChannel returns the channel with the widest range of values in box and its range.
+func widestChannel(box []colorCount) (channel, rng int) {
+	for ch := 0; ch < 3; ch++ {
+		lo, hi := 255, 0
+		for _, c := range box {
+			v := int(c.c[ch])
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if hi-lo > rng {
+			channel, rng = ch, hi-lo
+		}
+	}
+	return channel, rng
+}
@@ -0,0 +1,185 @@
+package aseprite
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func TestPlaybackOrder(t *testing.T) {
+	spr := testSprite(1, 1, 1, 1, 1, 1, 1, 1, 1, 1)
+	spr.Tags = []Tag{{Lo: 7, Hi: 8, LoopDirection: Reverse, Repeat: 2}}
+
+	for _, tt := range []struct {
+		Name      string
+		Tag       Tag
+		Seq       []int
+		LoopCount int
+	}{
+		{"forward", Tag{Lo: 1, Hi: 3}, []int{1, 2, 3}, 0},
+		{"forward_once", Tag{Lo: 1, Hi: 3, Repeat: 1}, []int{1, 2, 3}, -1},
+		{"forward_thrice", Tag{Lo: 1, Hi: 3, Repeat: 3}, []int{1, 2, 3}, 2},
+		{"reverse", Tag{Lo: 1, Hi: 3, LoopDirection: Reverse}, []int{3, 2, 1}, 0},
+		{"pingpong", Tag{Lo: 1, Hi: 4, LoopDirection: PingPong}, []int{1, 2, 3, 4, 3, 2}, 0},
+		{"pingpong_reverse", Tag{Lo: 1, Hi: 4, LoopDirection: PingPongReverse}, []int{4, 3, 2, 1, 2, 3}, 0},
+		{"pingpong_repeat", Tag{Lo: 1, Hi: 3, LoopDirection: PingPong, Repeat: 3}, []int{1, 2, 3, 2, 1, 2, 3}, -1},
+		{"pingpong_single", Tag{Lo: 2, Hi: 2, LoopDirection: PingPong}, []int{2}, 0},
+		// nested tags play their own animations
+		{"nested", Tag{Lo: 6, Hi: 9}, []int{6, 8, 7, 8, 7, 9}, 0},
+		{"nested_twice", Tag{Lo: 6, Hi: 9, Repeat: 2}, []int{6, 8, 7, 8, 7, 9}, 1},
+		{"nested_pingpong", Tag{Lo: 6, Hi: 9, LoopDirection: PingPong}, []int{6, 8, 7, 8, 7, 9, 8, 7, 8, 7}, 0},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			seq, loopCount, err := animation(spr, &tt.Tag)
+			require.NoError(t, err)
+			require.True(t, len(seq) == len(tt.Seq), "seq", seq)
+			for i := range seq {
+				require.True(t, seq[i] == tt.Seq[i], "seq", seq)
+			}
+			require.True(t, loopCount == tt.LoopCount, "loop count", loopCount)
+		})
+	}
+}
+
+func TestGIFDelays(t *testing.T) {
+	raw := makeTestFile(6, 4, 4, gradientLayers(0))
+	spr, err := Read(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	for i := range spr.Frames {
+		spr.Frames[i].Duration = 33 * time.Millisecond
+	}
+
+	g, err := GIF(spr, nil)
+	require.NoError(t, err)
+
+	// 33ms frames end at 3.3cs, 6.6cs, 9.9cs, ...
+	want := []int{3, 4, 3, 3, 4, 3}
+	total := 0
+	for i, d := range g.Delay {
+		require.True(t, d == want[i], "delay", i, g.Delay)
+		total += d
+	}
+	require.True(t, total == 20, "total", total)
+}
+
+func TestGIFPaletted(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/slime_paletted.aseprite")
+	require.NoError(t, err)
+
+	spr, err := ReadWithOptions(bytes.NewReader(raw), &Options{Trim: true})
+	require.NoError(t, err)
+
+	tag := spr.Tags[0]
+	g, err := GIF(spr, &tag)
+	require.NoError(t, err)
+	require.True(t, len(g.Image) == 6 && g.LoopCount == 0, "frames", len(g.Image))
+	require.True(t, g.Config.Width == 32 && g.Config.Height == 64, "size")
+
+	palette, transparent, _ := withTransparent(spr.Image.(*image.Paletted).Palette)
+	for i, img := range g.Image {
+		require.True(t, len(img.Palette) == len(palette), "palette", i)
+		require.True(t, img.Bounds().Size() == image.Pt(32, 64), "image size", i)
+	}
+
+	// pixels match the untrimmed frames
+	want := spriteFrame(spr, 2)
+	img := g.Image[2]
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 32; x++ {
+			c := want.NRGBAAt(x, y)
+			_, _, _, a := img.At(x, y).RGBA()
+			if c.A == 0 {
+				require.True(t, img.ColorIndexAt(x, y) == transparent, "transparent", x, y)
+			} else {
+				require.True(t, a != 0 && color.NRGBAModel.Convert(img.At(x, y)) == c, "pixel", x, y)
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&b, g))
+	_, err = gif.DecodeAll(&b)
+	require.NoError(t, err)
+}
+
+func TestGIFOpaquePalette(t *testing.T) {
+	img := image.NewPaletted(image.Rect(0, 0, 2, 1), color.Palette{color.Black, color.White})
+	img.Pix[1] = 1
+	spr := &Aseprite{
+		Image:  img,
+		Pages:  []image.Image{img},
+		Frames: []Frame{{Bounds: img.Rect, Size: img.Rect.Size(), Duration: 100 * time.Millisecond}},
+	}
+
+	// a transparent color is added to the palette
+	g, err := GIF(spr, nil)
+	require.NoError(t, err)
+	p := g.Image[0].Palette
+	require.True(t, len(p) == 3 && g.BackgroundIndex == 2, "palette", len(p), g.BackgroundIndex)
+	require.True(t, g.Image[0].Pix[0] == 0 && g.Image[0].Pix[1] == 1, "pixels", g.Image[0].Pix)
+
+	// full palettes are quantized to make room for the transparent color
+	img.Palette = make(color.Palette, 256)
+	for i := range img.Palette {
+		img.Palette[i] = color.NRGBA{uint8(i), uint8(i), uint8(i), 255}
+	}
+	g, err = GIF(spr, nil)
+	require.NoError(t, err)
+	p = g.Image[0].Palette
+	_, _, _, a := p[g.BackgroundIndex].RGBA()
+	require.True(t, len(p) <= 256 && a == 0, "transparent", len(p), a)
+	_, _, _, a = p[g.Image[0].Pix[1]].RGBA()
+	require.True(t, a != 0, "opaque pixel")
+}
+
+func TestGIFQuantize(t *testing.T) {
+	// few colors are kept exactly
+	raw := makeTestFile(2, 4, 4, []testLayer{{
+		Opacity: 255,
+		Pixel: func(frame, x, y int) color.NRGBA {
+			if x == 0 {
+				return color.NRGBA{}
+			}
+			return color.NRGBA{byte(x * 60), byte(y * 60), byte(frame * 200), 255}
+		},
+	}})
+	spr, err := Read(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	g, err := GIF(spr, nil)
+	require.NoError(t, err)
+	require.True(t, len(g.Image[0].Palette) == 2*3*4+1, "palette size", len(g.Image[0].Palette))
+
+	for i, img := range g.Image {
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				_, _, _, a := img.At(x, y).RGBA()
+				if x == 0 {
+					require.True(t, a == 0, "transparent", i, x, y)
+				} else {
+					want := color.NRGBA{byte(x * 60), byte(y * 60), byte(i * 200), 255}
+					require.True(t, img.At(x, y) == want, "pixel", i, x, y)
+				}
+			}
+		}
+	}
+
+	// many colors are reduced to 256
+	raw = makeTestFile(4, 64, 64, gradientLayers(0))
+	spr, err = Read(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	g, err = GIF(spr, nil)
+	require.NoError(t, err)
+	require.True(t, len(g.Image[0].Palette) == 256, "palette size", len(g.Image[0].Palette))
+
+	var b bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&b, g))
+}
@@ -0,0 +1,157 @@
+package aseprite
+
+import (
+	"image"
+	"image/color"
+)
+
+// GrayAlphaColor represents an 8-bit non-alpha-premultiplied gray color
+// with an 8-bit alpha channel.
+// It is the color type of grayscale Aseprite sprites.
+type GrayAlphaColor struct {
+	Y, A uint8
+}
+
+// RGBA implements color.Color.
+func (c GrayAlphaColor) RGBA() (r, g, b, a uint32) {
+	y := uint32(c.Y)
+	y |= y << 8
+	a = uint32(c.A)
+	a |= a << 8
+	y = y * a / 0xffff
+	return y, y, y, a
+}
+
+// GrayAlphaModel is the color model of grayscale sprites.
+var GrayAlphaModel color.Model = color.ModelFunc(grayAlphaModel)
+
+func grayAlphaModel(c color.Color) color.Color {
+	switch c := c.(type) {
+	case GrayAlphaColor:
+		return c
+	case color.NRGBA:
+		if c.A == 0 {
+			return GrayAlphaColor{}
+		}
+		// Avoid the precision loss of premultiplying.
+		return GrayAlphaColor{luma(uint32(c.R)*0x101, uint32(c.G)*0x101, uint32(c.B)*0x101), c.A}
+	}
+
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return GrayAlphaColor{}
+	} else if a != 0xffff {
+		r = (r * 0xffff) / a
+		g = (g * 0xffff) / a
+		b = (b * 0xffff) / a
+	}
+
+	return GrayAlphaColor{luma(r, g, b), uint8(a >> 8)}
+}
+
+// luma converts 16-bit color channels to an 8-bit gray value
+// using the same coefficients as color.GrayModel.
+func luma(r, g, b uint32) uint8 {
+	return uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+}
+
+// GrayAlpha is an in-memory image whose At method returns GrayAlphaColor values.
+type GrayAlpha struct {
+	// Pix holds the image's pixels, as gray and alpha values.
+	// The pixel at (x, y) starts at Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*2].
+	Pix []uint8
+	// Stride is the Pix stride (in bytes) between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+// NewGrayAlpha returns a new GrayAlpha image with the given bounds.
+func NewGrayAlpha(r image.Rectangle) *GrayAlpha {
+	return &GrayAlpha{
+		Pix:    make([]uint8, 2*r.Dx()*r.Dy()),
+		Stride: 2 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+// ColorModel implements image.Image.
+func (p *GrayAlpha) ColorModel() color.Model {
+	return GrayAlphaModel
+}
+
+// Bounds implements image.Image.
+func (p *GrayAlpha) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+// At implements image.Image.
+func (p *GrayAlpha) At(x, y int) color.Color {
+	return p.GrayAlphaAt(x, y)
+}
+
+// GrayAlphaAt returns the color of the pixel at (x, y).
+func (p *GrayAlpha) GrayAlphaAt(x, y int) GrayAlphaColor {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return GrayAlphaColor{}
+	}
+	i := p.PixOffset(x, y)
+	return GrayAlphaColor{p.Pix[i], p.Pix[i+1]}
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *GrayAlpha) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*2
+}
+
+// Set implements draw.Image.
+func (p *GrayAlpha) Set(x, y int, c color.Color) {
+	p.SetGrayAlpha(x, y, GrayAlphaModel.Convert(c).(GrayAlphaColor))
+}
+
+// SetGrayAlpha sets the color of the pixel at (x, y).
+func (p *GrayAlpha) SetGrayAlpha(x, y int, c GrayAlphaColor) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	p.Pix[i] = c.Y
+	p.Pix[i+1] = c.A
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *GrayAlpha) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside
+	// either r1 or r2 if the intersection is empty. Without explicitly checking for
+	// this, the Pix[i:] expression below can panic.
+	if r.Empty() {
+		return &GrayAlpha{}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &GrayAlpha{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// Opaque scans the entire image and reports whether it is fully opaque.
+func (p *GrayAlpha) Opaque() bool {
+	if p.Rect.Empty() {
+		return true
+	}
+	i0, i1 := 1, p.Rect.Dx()*2
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		for i := i0; i < i1; i += 2 {
+			if p.Pix[i] != 0xff {
+				return false
+			}
+		}
+		i0 += p.Stride
+		i1 += p.Stride
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package aseprite
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"testing"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func TestGrayAlphaModel(t *testing.T) {
+	for _, tt := range []struct {
+		Name string
+		In   color.Color
+		Want GrayAlphaColor
+	}{
+		{"gray", color.Gray{100}, GrayAlphaColor{100, 255}},
+		{"nrgba", color.NRGBA{77, 77, 77, 3}, GrayAlphaColor{77, 3}},
+		{"rgba", color.RGBA{50, 50, 50, 128}, GrayAlphaColor{99, 128}},
+		{"transparent", color.NRGBA{10, 20, 30, 0}, GrayAlphaColor{}},
+		{"white", color.White, GrayAlphaColor{255, 255}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			got := GrayAlphaModel.Convert(tt.In)
+			require.True(t, got == tt.Want, "got", got, "want", tt.Want)
+		})
+	}
+}
+
+func TestGrayAlpha(t *testing.T) {
+	img := NewGrayAlpha(image.Rect(-2, -2, 6, 4))
+	require.True(t, img.Opaque() == false, "opaque")
+
+	draw.Draw(img, img.Bounds(), image.NewUniform(GrayAlphaColor{200, 255}), image.Point{}, draw.Src)
+	require.True(t, img.Opaque(), "not opaque")
+
+	img.Set(3, 1, color.NRGBA{40, 40, 40, 128})
+	require.True(t, img.GrayAlphaAt(3, 1) == GrayAlphaColor{40, 128}, "set")
+	require.True(t, img.At(10, 10) == GrayAlphaColor{}, "out of bounds")
+
+	sub := img.SubImage(image.Rect(3, 1, 5, 3)).(*GrayAlpha)
+	require.True(t, sub.Bounds() == image.Rect(3, 1, 5, 3), "sub bounds")
+	require.True(t, sub.GrayAlphaAt(3, 1) == GrayAlphaColor{40, 128}, "sub pixel")
+
+	r, g, b, a := GrayAlphaColor{255, 128}.RGBA()
+	require.True(t, r == 0x8080 && g == r && b == r && a == 0x8080, "rgba")
+}
+
+func TestDecodeGrayscale(t *testing.T) {
+	f, err := os.Open("./testfiles/slime_grayscale.aseprite")
+	require.NoError(t, err)
+	defer f.Close()
+
+	spr, err := Read(f)
+	require.NoError(t, err)
+
+	_, ok := spr.Image.(*GrayAlpha)
+	require.True(t, ok, "atlas type")
+
+	_, err = f.Seek(0, 0)
+	require.NoError(t, err)
+
+	conf, err := DecodeConfig(f)
+	require.NoError(t, err)
+	require.True(t, conf.ColorModel == spr.ColorModel(), "color model")
+	require.True(t, conf.Width == spr.Bounds().Dx() && conf.Height == spr.Bounds().Dy(), "dimensions")
+}
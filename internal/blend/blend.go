@@ -1,28 +1,23 @@
-// Copyright (c) 2012 Guillermo Estrada. All rights reserved.
-// Use of this source code is governed by a MIT
-// license that can be found in the LICENSE file.
-// http://github.com/phrozen/blend
+// Copyright (c) 2001-2018 David Capello. All rights reserved.
+// Use of this source code is governed by the MIT license of Aseprite
+// that can be found in the LICENSE file in this directory.
+// https://github.com/aseprite/aseprite/blob/main/src/doc/blend_funcs.cpp
 
+// Package blend implements the blend modes of Aseprite.
+//
+// The blend functions are ported from Aseprite and use the same
+// 8-bit integer math on non-premultiplied colors.
 package blend
 
 import (
 	"image"
 	"image/color"
-	"image/draw"
 	"math"
 )
 
-// Constants of max and mid values for uint16 for internal use.
-// This can be changed to make the algorithms use uint8 instead,
-// but they are kept this way to provide more accurate calculations
-// and to support all of the color modes in the 'image' package.
-const (
-	max = float64(math.MaxUint16) // max range of color.Color
-	mid = max / 2
-)
-
-// BlendFunc blends the source color with the destination color.
-type BlendFunc func(dst, src color.Color) color.Color
+// BlendFunc blends the source color s onto the backdrop color b.
+// The result has the color of the blend and the alpha of s.
+type BlendFunc func(b, s color.NRGBA) color.NRGBA
 
 // Modes lists all blend modes that are supported by the Aseprite file format.
 var Modes = [19]BlendFunc{
@@ -48,7 +43,7 @@ var Modes = [19]BlendFunc{
 }
 
 // clip clips r against each image's bounds (after translating into the
-// destination image's coordinate space) and shifts the points sp and mp by
+// destination image's coordinate space) and shifts the points sp0 and sp1 by
 // the same amount as the change in r.Min.
 func clip(dst image.Image, r *image.Rectangle, src0 image.Image,
 	sp0 *image.Point, src1 image.Image, sp1 *image.Point) {
@@ -64,187 +59,244 @@ func clip(dst image.Image, r *image.Rectangle, src0 image.Image,
 	sp1.Y += dy
 }
 
-// Blend blends src0 (top layer) into src1 (bottom layer) using mode
-// and stores the result in dst.
-func Blend(dst draw.Image, r image.Rectangle, src0 image.Image, sp0 image.Point,
-	src1 image.Image, sp1 image.Point, mode BlendFunc) {
-	clip(dst, &r, src0, &sp0, src1, &sp1)
-	if r.Empty() {
-		return
+// mul multiplies two 8-bit values as fixed point numbers in [0, 1].
+// It is the MUL_UN8 macro of Aseprite and also accepts negative values of a.
+func mul(a, b int32) int32 {
+	t := a*b + 0x80
+	return ((t >> 8) + t) >> 8
+}
+
+// div divides two 8-bit values as fixed point numbers in [0, 1].
+// It is the DIV_UN8 macro of Aseprite.
+func div(a, b int32) int32 {
+	return (a*0xff + b/2) / b
+}
+
+func blendPerChannel(b, s color.NRGBA, blend func(b, s int32) int32) color.NRGBA {
+	return color.NRGBA{
+		R: uint8(blend(int32(b.R), int32(s.R))),
+		G: uint8(blend(int32(b.G), int32(s.G))),
+		B: uint8(blend(int32(b.B), int32(s.B))),
+		A: s.A,
 	}
+}
+
+func multiply(b, s int32) int32 {
+	return mul(b, s)
+}
 
-	for y := r.Min.Y; y < r.Max.Y; y++ {
-		for x := r.Min.X; x < r.Max.X; x++ {
-			src0col := src0.At(x+sp0.X, y+sp0.Y)
-			// aseprite does not blend transparent pixels.
-			if _, _, _, a := src0col.RGBA(); a == 0 {
-				dst.Set(x, y, src0col)
-			} else {
-				dst.Set(x, y, mode(src1.At(x+sp1.X, y+sp1.Y), src0col))
-			}
-		}
+func screen(b, s int32) int32 {
+	return b + s - mul(b, s)
+}
+
+func overlay(b, s int32) int32 {
+	return hardLight(s, b)
+}
+
+func darken(b, s int32) int32 {
+	if b < s {
+		return b
 	}
+	return s
 }
 
-func blendPerChannel(dst, src color.Color, blend func(float64, float64) float64) color.Color {
-	d := color2rgbaf64(dst)
-	s := color2rgbaf64(src)
-	return color.RGBA{
-		R: clampToByte(blend(d.r, s.r)/256 + 0.5),
-		G: clampToByte(blend(d.g, s.g)/256 + 0.5),
-		B: clampToByte(blend(d.b, s.b)/256 + 0.5),
-		A: clampToByte(d.a/256 + 0.5),
+func lighten(b, s int32) int32 {
+	if b > s {
+		return b
 	}
+	return s
 }
 
-// Normal.
-func Normal(dst, src color.Color) color.Color {
-	return src
+func hardLight(b, s int32) int32 {
+	if s < 128 {
+		return multiply(b, s<<1)
+	}
+	return screen(b, (s<<1)-255)
 }
 
-// Darken.
-func Darken(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		return math.Min(d, s)
-	})
+func difference(b, s int32) int32 {
+	if b > s {
+		return b - s
+	}
+	return s - b
 }
 
-// Multiply.
-func Multiply(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		return s * d / max
-	})
+func exclusion(b, s int32) int32 {
+	return b + s - 2*mul(b, s)
 }
 
-// Color burn.
-func ColorBurn(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		if s == 0.0 {
-			return s
-		}
-		return math.Max(0.0, max-((max-d)*max/s))
-	})
+func divide(b, s int32) int32 {
+	if b == 0 {
+		return 0
+	} else if b >= s {
+		return 255
+	}
+	return div(b, s)
 }
 
-// Lighten.
-func Lighten(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		return math.Max(d, s)
-	})
+func colorDodge(b, s int32) int32 {
+	if b == 0 {
+		return 0
+	}
+	s = 255 - s
+	if b >= s {
+		return 255
+	}
+	return div(b, s)
 }
 
-// Screen.
-func Screen(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		return s + d - s*d/max
-	})
+func colorBurn(b, s int32) int32 {
+	if b == 255 {
+		return 255
+	}
+	b = 255 - b
+	if b >= s {
+		return 0
+	}
+	return 255 - div(b, s)
 }
 
-// Color dodge.
-func ColorDodge(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		if s == max {
-			return s
-		}
-		return math.Min(max, (d * max / (max - s)))
-	})
+func softLight(ib, is int32) int32 {
+	b := float64(ib) / 255
+	s := float64(is) / 255
+
+	var d, r float64
+	if b <= 0.25 {
+		d = ((16*b-12)*b + 4) * b
+	} else {
+		d = math.Sqrt(b)
+	}
+
+	if s <= 0.5 {
+		r = b - (1-2*s)*b*(1-b)
+	} else {
+		r = b + (2*s-1)*(d-b)
+	}
+
+	return int32(r*255 + 0.5)
+}
+
+func addition(b, s int32) int32 {
+	if b+s > 255 {
+		return 255
+	}
+	return b + s
+}
+
+func subtract(b, s int32) int32 {
+	if b-s < 0 {
+		return 0
+	}
+	return b - s
+}
+
+// Normal.
+func Normal(b, s color.NRGBA) color.NRGBA {
+	return s
+}
+
+// Multiply.
+func Multiply(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, multiply)
+}
+
+// Screen.
+func Screen(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, screen)
 }
 
 // Overlay.
-func Overlay(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		if d < mid {
-			return 2 * s * d / max
-		}
-		return max - 2*(max-s)*(max-d)/max
-	})
+func Overlay(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, overlay)
 }
 
-// Soft Light.
-func SoftLight(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		return (d / max) * (d + (2*s/max)*(max-d))
-	})
+// Darken.
+func Darken(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, darken)
 }
 
-// Hard Light.
-func HardLight(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		if s > mid {
-			return d + (max-d)*((s-mid)/mid)
-		}
-		return d * s / mid
-	})
+// Lighten.
+func Lighten(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, lighten)
 }
 
-// Addition.
-func Addition(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		if s+d > max {
-			return max
-		}
-		return s + d
-	})
+// Color dodge.
+func ColorDodge(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, colorDodge)
 }
 
-// Subtract.
-func Subtract(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		if d-s < 0.0 {
-			return 0.0
-		}
-		return d - s
-	})
+// Color burn.
+func ColorBurn(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, colorBurn)
 }
 
-// Divide.
-func Divide(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		return (d*max)/s + 1.0
-	})
+// Hard Light.
+func HardLight(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, hardLight)
+}
+
+// Soft Light.
+func SoftLight(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, softLight)
 }
 
 // Difference.
-func Difference(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		return math.Abs(s - d)
-	})
+func Difference(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, difference)
 }
 
 // Exclusion.
-func Exclusion(dst, src color.Color) color.Color {
-	return blendPerChannel(dst, src, func(d, s float64) float64 {
-		return s + d - s*d/mid
-	})
+func Exclusion(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, exclusion)
 }
 
 // Hue.
-func Hue(dst, src color.Color) color.Color {
-	s := rgb2hsl(src)
-	if s.s == 0.0 {
-		return dst
-	}
-	d := rgb2hsl(dst)
-	return hsl2rgb(s.h, d.s, d.l)
+func Hue(b, s color.NRGBA) color.NRGBA {
+	c := rgbf64(b)
+	sat, lum := c.sat(), c.lum()
+	c = rgbf64(s)
+	c.setSat(sat)
+	c.setLum(lum)
+	return c.nrgba(s.A)
 }
 
 // Saturation.
-func Saturation(dst, src color.Color) color.Color {
-	s := rgb2hsl(src)
-	d := rgb2hsl(dst)
-	return hsl2rgb(d.h, s.s, d.l)
+func Saturation(b, s color.NRGBA) color.NRGBA {
+	sat := rgbf64(s).sat()
+	c := rgbf64(b)
+	lum := c.lum()
+	c.setSat(sat)
+	c.setLum(lum)
+	return c.nrgba(s.A)
 }
 
 // Color.
-func Color(dst, src color.Color) color.Color {
-	s := rgb2hsl(src)
-	d := rgb2hsl(dst)
-	return hsl2rgb(s.h, s.s, d.l)
+func Color(b, s color.NRGBA) color.NRGBA {
+	lum := rgbf64(b).lum()
+	c := rgbf64(s)
+	c.setLum(lum)
+	return c.nrgba(s.A)
 }
 
 // Luminosity.
-func Luminosity(dst, src color.Color) color.Color {
-	s := rgb2hsl(src)
-	d := rgb2hsl(dst)
-	return hsl2rgb(d.h, d.s, s.l)
+func Luminosity(b, s color.NRGBA) color.NRGBA {
+	lum := rgbf64(s).lum()
+	c := rgbf64(b)
+	c.setLum(lum)
+	return c.nrgba(s.A)
+}
+
+// Addition.
+func Addition(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, addition)
+}
+
+// Subtract.
+func Subtract(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, subtract)
+}
+
+// Divide.
+func Divide(b, s color.NRGBA) color.NRGBA {
+	return blendPerChannel(b, s, divide)
 }
@@ -1,8 +1,11 @@
 package blend
 
 import (
+	"bytes"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	"image/jpeg"
 	"os"
 	"strings"
@@ -58,10 +61,168 @@ func TestBlendModes(t *testing.T) {
 		"Divide",
 	} {
 		t.Run(name, func(t *testing.T) {
-			img := image.NewRGBA(src.Bounds())
-			Blend(img, img.Bounds(), src, image.Point{}, dst, image.Point{}, Modes[i])
+			img := image.NewNRGBA(src.Bounds())
+			draw.Draw(img, img.Bounds(), dst, image.Point{}, draw.Src)
+			Composite(img, img.Bounds(), src, image.Point{}, i, 255)
 
 			require.NoError(t, jpgEncode(fmt.Sprintf("out_%s.jpg", strings.ToLower(name)), img))
 		})
 	}
 }
+
+// opaqueImage hides the concrete type of an image to force the generic path.
+type opaqueImage struct{ image.Image }
+
+type opaqueDrawImage struct{ draw.Image }
+
+// testImages returns sources of every supported type and a backdrop
+// that together cover all combinations of 8-bit channel values and alpha.
+func testImages() (srcs []image.Image, dst *image.RGBA) {
+	r := image.Rect(0, 0, 256, 256)
+
+	nrgba := image.NewNRGBA(r)
+	rgba := image.NewRGBA(r)
+	pal := make(color.Palette, 256)
+	for i := range pal {
+		pal[i] = color.NRGBA{uint8(i), uint8(255 - i), uint8(i * 7), uint8(i * 3)}
+	}
+	paletted := image.NewPaletted(r, pal)
+	dst = image.NewRGBA(r)
+
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			nrgba.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(x * 3), uint8(255 - x), uint8(y)})
+			rgba.SetRGBA(x, y, color.RGBA{uint8(x * y / 255), uint8(x * y / 511), 0, uint8(y)})
+			paletted.SetColorIndex(x, y, uint8(x^y))
+			dst.SetRGBA(x, y, color.RGBA{uint8(y), uint8(x), uint8(x + y), uint8(y ^ x)})
+		}
+	}
+
+	return []image.Image{nrgba, rgba, paletted}, dst
+}
+
+func TestCompositeFast(t *testing.T) {
+	srcs, backdrop := testImages()
+	nbackdrop := image.NewNRGBA(backdrop.Bounds())
+	draw.Draw(nbackdrop, nbackdrop.Bounds(), backdrop, image.Point{}, draw.Src)
+
+	for _, src := range srcs {
+		for _, dst := range []draw.Image{backdrop, nbackdrop} {
+			for mode := range Modes {
+				for _, opacity := range []uint8{255, 100} {
+					t.Run(fmt.Sprintf("%T/%T/%d/%d", src, dst, mode, opacity), func(t *testing.T) {
+						r, sp := image.Rect(7, 11, 250, 240), image.Pt(3, 9)
+
+						want := image.NewNRGBA(dst.Bounds())
+						draw.Draw(want, want.Bounds(), dst, image.Point{}, draw.Src)
+						Composite(opaqueDrawImage{want}, r, opaqueImage{src}, sp, mode, opacity)
+
+						got := image.NewNRGBA(dst.Bounds())
+						draw.Draw(got, got.Bounds(), dst, image.Point{}, draw.Src)
+						Composite(got, r, src, sp, mode, opacity)
+
+						require.True(t, bytes.Equal(got.Pix, want.Pix), "output differs from generic path")
+					})
+				}
+			}
+		}
+	}
+}
+
+// TestComposite checks alpha compositing against values computed by hand
+// from the formulas in Aseprite's blend_funcs.cpp.
+func TestComposite(t *testing.T) {
+	for _, tt := range []struct {
+		Name    string
+		Mode    int
+		Opacity uint8
+		B, S    color.NRGBA
+		Want    color.NRGBA
+	}{
+		{"transparent backdrop", 0, 255, color.NRGBA{}, color.NRGBA{200, 100, 50, 128}, color.NRGBA{200, 100, 50, 128}},
+		{"transparent source", 0, 255, color.NRGBA{1, 2, 3, 4}, color.NRGBA{}, color.NRGBA{1, 2, 3, 4}},
+		{"semi-transparent source", 0, 255, color.NRGBA{0, 0, 255, 255}, color.NRGBA{255, 0, 0, 128}, color.NRGBA{128, 0, 127, 255}},
+		{"opacity", 0, 128, color.NRGBA{0, 0, 255, 255}, color.NRGBA{255, 0, 0, 128}, color.NRGBA{64, 0, 191, 255}},
+		{"multiply over transparent", 1, 128, color.NRGBA{}, color.NRGBA{100, 100, 100, 255}, color.NRGBA{100, 100, 100, 128}},
+		{"multiply over opaque", 1, 255, color.NRGBA{200, 200, 200, 255}, color.NRGBA{100, 100, 100, 255}, color.NRGBA{78, 78, 78, 255}},
+		{"multiply over semi-transparent", 1, 255, color.NRGBA{200, 200, 200, 128}, color.NRGBA{100, 100, 100, 255}, color.NRGBA{83, 83, 83, 255}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+			img.SetNRGBA(0, 0, tt.B)
+			src := image.NewUniform(tt.S)
+			Composite(img, img.Bounds(), src, image.Point{}, tt.Mode, tt.Opacity)
+			got := img.NRGBAAt(0, 0)
+			require.True(t, got == tt.Want, "got", got, "want", tt.Want)
+		})
+	}
+}
+
+// TestBlendFuncs checks the blend functions against values
+// computed by hand from the formulas in Aseprite's blend_funcs.cpp.
+func TestBlendFuncs(t *testing.T) {
+	gray := func(v uint8) color.NRGBA { return color.NRGBA{v, v, v, 255} }
+	red := color.NRGBA{255, 0, 0, 255}
+
+	for _, tt := range []struct {
+		Name string
+		Mode BlendFunc
+		B, S color.NRGBA
+		Want color.NRGBA
+	}{
+		{"Normal", Normal, gray(10), gray(20), gray(20)},
+		{"Multiply", Multiply, gray(128), gray(255), gray(128)},
+		{"Multiply", Multiply, gray(200), gray(100), gray(78)},
+		{"Screen", Screen, gray(200), gray(100), gray(222)},
+		{"Overlay", Overlay, gray(100), gray(200), gray(157)},
+		{"Darken", Darken, gray(10), gray(20), gray(10)},
+		{"Lighten", Lighten, gray(10), gray(20), gray(20)},
+		{"ColorDodge", ColorDodge, gray(100), gray(155), gray(255)},
+		{"ColorDodge", ColorDodge, gray(50), gray(155), gray(128)},
+		{"ColorBurn", ColorBurn, gray(200), gray(100), gray(115)},
+		{"HardLight", HardLight, gray(100), gray(200), gray(188)},
+		{"SoftLight", SoftLight, gray(255), gray(0), gray(255)},
+		{"SoftLight", SoftLight, gray(128), gray(255), gray(181)},
+		{"Difference", Difference, gray(10), gray(250), gray(240)},
+		{"Exclusion", Exclusion, gray(128), gray(255), gray(127)},
+		// 0.3 + 0.59 + 0.11 < 1 in floating point, truncating to 254.
+		{"Hue", Hue, gray(255), red, gray(254)},
+		{"Saturation", Saturation, red, gray(128), gray(76)},
+		{"Color", Color, gray(0), red, gray(0)},
+		{"Luminosity", Luminosity, gray(100), gray(0), gray(0)},
+		{"Addition", Addition, gray(200), gray(100), gray(255)},
+		{"Subtract", Subtract, gray(200), gray(100), gray(100)},
+		{"Subtract", Subtract, gray(100), gray(200), gray(0)},
+		{"Divide", Divide, gray(100), gray(200), gray(128)},
+		{"Divide", Divide, gray(200), gray(100), gray(255)},
+		{"Divide", Divide, gray(0), gray(0), gray(0)},
+		{"Alpha", Multiply, gray(200), color.NRGBA{100, 100, 100, 42}, color.NRGBA{78, 78, 78, 42}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			got := tt.Mode(tt.B, tt.S)
+			require.True(t, got == tt.Want, "got", got, "want", tt.Want)
+		})
+	}
+}
+
+func BenchmarkComposite(b *testing.B) {
+	srcs, backdrop := testImages()
+	src := srcs[0]
+
+	for _, mode := range []int{0, 1, 9, 12, 18} {
+		dst := image.NewNRGBA(backdrop.Bounds())
+		draw.Draw(dst, dst.Bounds(), backdrop, image.Point{}, draw.Src)
+
+		b.Run(fmt.Sprintf("fast/%d", mode), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Composite(dst, dst.Bounds(), src, image.Point{}, mode, 200)
+			}
+		})
+
+		b.Run(fmt.Sprintf("generic/%d", mode), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Composite(opaqueDrawImage{dst}, dst.Bounds(), opaqueImage{src}, image.Point{}, mode, 200)
+			}
+		})
+	}
+}
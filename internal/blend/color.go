@@ -1,7 +1,7 @@
-// Copyright (c) 2012 Guillermo Estrada. All rights reserved.
-// Use of this source code is governed by a MIT
-// license that can be found in the LICENSE file.
-// http://github.com/phrozen/blend
+// Copyright (c) 2001-2018 David Capello. All rights reserved.
+// Use of this source code is governed by the MIT license of Aseprite
+// that can be found in the LICENSE file in this directory.
+// https://github.com/aseprite/aseprite/blob/main/src/doc/blend_funcs.cpp
 
 package blend
 
@@ -10,6 +10,27 @@ import (
 	"math"
 )
 
+// rgb is a color with channels in the range [0, 1]
+// used by the non-separable blend modes.
+type rgb struct {
+	r, g, b float64
+}
+
+func rgbf64(c color.NRGBA) rgb {
+	return rgb{float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255}
+}
+
+// nrgba converts c to an 8-bit color with alpha a,
+// truncating the channels like Aseprite does.
+func (c rgb) nrgba(a uint8) color.NRGBA {
+	return color.NRGBA{
+		R: clampToByte(255 * c.r),
+		G: clampToByte(255 * c.g),
+		B: clampToByte(255 * c.b),
+		A: a,
+	}
+}
+
 func clampToByte(a float64) byte {
 	if a < 0 {
 		return 0
@@ -19,90 +40,86 @@ func clampToByte(a float64) byte {
 	return byte(a)
 }
 
-type rgbaf64 struct {
-	r, g, b, a float64
+func (c rgb) lum() float64 {
+	return 0.3*c.r + 0.59*c.g + 0.11*c.b
 }
 
-func color2rgbaf64(c color.Color) rgbaf64 {
-	r, g, b, a := c.RGBA()
-	return rgbaf64{float64(r), float64(g), float64(b), float64(a)}
+func (c rgb) sat() float64 {
+	return math.Max(c.r, math.Max(c.g, c.b)) - math.Min(c.r, math.Min(c.g, c.b))
 }
 
-type hslf64 struct {
-	h, s, l float64
-}
+func (c *rgb) clip() {
+	l := c.lum()
+	n := math.Min(c.r, math.Min(c.g, c.b))
+	x := math.Max(c.r, math.Max(c.g, c.b))
 
-func rgb2hsl(c color.Color) hslf64 {
-	var h, s, l float64
-	cr, cg, cb, _ := c.RGBA()
-	r := float64(cr) / max
-	g := float64(cg) / max
-	b := float64(cb) / max
-	cmax := math.Max(math.Max(r, g), b)
-	cmin := math.Min(math.Min(r, g), b)
-	l = (cmax + cmin) / 2.0
-	if cmax != cmin { // Chromatic, else Achromatic.
-		delta := cmax - cmin
-		if l > 0.5 {
-			s = delta / (2.0 - cmax - cmin)
-		} else {
-			s = delta / (cmax + cmin)
-		}
-		switch cmax {
-		case r:
-			h = (g - b) / delta
-			if g < b {
-				h += 6.0
-			}
-		case g:
-			h = (b-r)/delta + 2.0
-		case b:
-			h = (r-g)/delta + 4.0
-		}
-		h /= 6.0
+	if n < 0 {
+		c.r = l + (((c.r - l) * l) / (l - n))
+		c.g = l + (((c.g - l) * l) / (l - n))
+		c.b = l + (((c.b - l) * l) / (l - n))
+	}
+
+	if x > 1 {
+		c.r = l + (((c.r - l) * (1 - l)) / (x - l))
+		c.g = l + (((c.g - l) * (1 - l)) / (x - l))
+		c.b = l + (((c.b - l) * (1 - l)) / (x - l))
 	}
-	return hslf64{h, s, l}
 }
 
-func hsl2rgb(h, s, l float64) color.Color {
-	var r, g, b float64
-	if s == 0 {
-		r, g, b = l, l, l
-	} else {
-		var q float64
-		if l < 0.5 {
-			q = l * (1 + s)
-		} else {
-			q = l + s - s*l
-		}
-		p := 2*l - q
-		r = hue2rgb(p, q, h+1.0/3)
-		g = hue2rgb(p, q, h)
-		b = hue2rgb(p, q, h-1.0/3)
+func (c *rgb) setLum(l float64) {
+	d := l - c.lum()
+	c.r += d
+	c.g += d
+	c.b += d
+	c.clip()
+}
+
+// minRef, midRef and maxRef select channels the same way as the
+// MIN, MID and MAX macros of Aseprite, which matters when channels are equal.
+
+func minRef(x, y *float64) *float64 {
+	if *x < *y {
+		return x
 	}
-	return color.RGBA{
-		R: clampToByte(r*math.MaxUint8 + 0.5),
-		G: clampToByte(g*math.MaxUint8 + 0.5),
-		B: clampToByte(b*math.MaxUint8 + 0.5),
-		A: math.MaxUint8,
+	return y
+}
+
+func maxRef(x, y *float64) *float64 {
+	if *x > *y {
+		return x
 	}
+	return y
 }
 
-func hue2rgb(p, q, t float64) float64 {
-	if t < 0.0 {
-		t += 1.0
-	} else if t > 1.0 {
-		t -= 1.0
+func midRef(x, y, z *float64) *float64 {
+	if *x > *y {
+		if *y > *z {
+			return y
+		} else if *x > *z {
+			return z
+		}
+		return x
+	} else if *y > *z {
+		if *z > *x {
+			return z
+		}
+		return x
 	}
+	return y
+}
 
-	switch {
-	case t < 1.0/6.0:
-		return p + (q-p)*6.0*t
-	case t < 0.5:
-		return q
-	case t < 2.0/3.0:
-		return p + (q-p)*(2.0/3.0-t)*6.0
-	default:
-		return p
+func (c *rgb) setSat(s float64) {
+	min := minRef(&c.r, minRef(&c.g, &c.b))
+	mid := midRef(&c.r, &c.g, &c.b)
+	max := maxRef(&c.r, maxRef(&c.g, &c.b))
+
+	if *max > *min {
+		*mid = ((*mid - *min) * s) / (*max - *min)
+		*max = s
+	} else {
+		*mid = 0
+		*max = 0
 	}
+
+	*min = 0
 }
@@ -0,0 +1,118 @@
+// Copyright (c) 2001-2018 David Capello. All rights reserved.
+// Use of this source code is governed by the MIT license of Aseprite
+// that can be found in the LICENSE file in this directory.
+// https://github.com/aseprite/aseprite/blob/main/src/doc/blend_funcs.cpp
+
+package blend
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// MulOpacity multiplies two opacities the same way as Aseprite.
+func MulOpacity(a, b uint8) uint8 {
+	return uint8(mul(int32(a), int32(b)))
+}
+
+// normal composites s over b with the given opacity.
+// It is rgba_blender_normal of Aseprite.
+func normal(b, s color.NRGBA, opacity uint8) color.NRGBA {
+	if b.A == 0 {
+		s.A = uint8(mul(int32(s.A), int32(opacity)))
+		return s
+	} else if s.A == 0 {
+		return b
+	}
+
+	ba := int32(b.A)
+	sa := mul(int32(s.A), int32(opacity))
+	ra := sa + ba - mul(ba, sa)
+
+	return color.NRGBA{
+		R: uint8(int32(b.R) + (int32(s.R)-int32(b.R))*sa/ra),
+		G: uint8(int32(b.G) + (int32(s.G)-int32(b.G))*sa/ra),
+		B: uint8(int32(b.B) + (int32(s.B)-int32(b.B))*sa/ra),
+		A: uint8(ra),
+	}
+}
+
+// merge interpolates between b and s by opacity.
+// It is rgba_blender_merge of Aseprite.
+func merge(b, s color.NRGBA, opacity uint8) color.NRGBA {
+	var r color.NRGBA
+
+	op := int32(opacity)
+
+	if b.A == 0 {
+		r.R, r.G, r.B = s.R, s.G, s.B
+	} else if s.A == 0 {
+		r.R, r.G, r.B = b.R, b.G, b.B
+	} else {
+		r.R = uint8(int32(b.R) + mul(int32(s.R)-int32(b.R), op))
+		r.G = uint8(int32(b.G) + mul(int32(s.G)-int32(b.G), op))
+		r.B = uint8(int32(b.B) + mul(int32(s.B)-int32(b.B), op))
+	}
+
+	r.A = uint8(int32(b.A) + mul(int32(s.A)-int32(b.A), op))
+	if r.A == 0 {
+		r.R, r.G, r.B = 0, 0, 0
+	}
+
+	return r
+}
+
+// composite composites s onto b using mode and opacity.
+//
+// The blended color is composited over the backdrop with the alpha of s
+// multiplied by opacity. Where the backdrop is partially transparent,
+// the result is interpolated towards normal blending by the backdrop alpha,
+// which is the blending method of Aseprite since version 1.3.
+func composite(b, s color.NRGBA, mode BlendFunc, opacity uint8) color.NRGBA {
+	if b.A == 0 || mode == nil {
+		return normal(b, s, opacity)
+	}
+
+	return compositeBlended(b, s, mode(b, s), opacity)
+}
+
+// compositeBlended composites s onto the opaque or partially transparent
+// backdrop b, where x is the color of s blended onto b.
+func compositeBlended(b, s, x color.NRGBA, opacity uint8) color.NRGBA {
+	n := normal(b, s, opacity)
+	x = normal(b, x, opacity)
+	sa := mul(int32(s.A), int32(opacity))
+	return merge(merge(n, x, b.A), x, uint8(mul(int32(b.A), sa)))
+}
+
+// Composite composites src onto dst within r using the blend function
+// Modes[mode] and opacity, the same way that Aseprite renders a cel
+// onto the layers below it.
+//
+// Compositing is fastest when dst is an *image.NRGBA or *image.RGBA and
+// src is an *image.RGBA, *image.NRGBA or *image.Paletted.
+func Composite(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point, mode int, opacity uint8) {
+	dp := r.Min
+	clip(dst, &r, src, &sp, dst, &dp)
+	if r.Empty() {
+		return
+	}
+
+	if !compositeFast(dst, r, src, sp, mode, opacity) {
+		// Normal blending only needs the opacity.
+		fn := Modes[mode]
+		if mode == 0 {
+			fn = nil
+		}
+
+		d := sp.Sub(r.Min)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				s := color.NRGBAModel.Convert(src.At(x+d.X, y+d.Y)).(color.NRGBA)
+				b := color.NRGBAModel.Convert(dst.At(x, y)).(color.NRGBA)
+				dst.Set(x, y, composite(b, s, fn, opacity))
+			}
+		}
+	}
+}
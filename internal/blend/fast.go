@@ -0,0 +1,214 @@
+package blend
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// channelModes lists the per-channel functions of the separable blend modes,
+// which compositeFast applies directly to the channels of the pixels.
+// Non-separable modes are nil.
+var channelModes = [len(Modes)]func(b, s int32) int32{
+	1:  multiply,
+	2:  screen,
+	3:  overlay,
+	4:  darken,
+	5:  lighten,
+	6:  colorDodge,
+	7:  colorBurn,
+	8:  hardLight,
+	9:  softLight,
+	10: difference,
+	11: exclusion,
+	16: addition,
+	17: subtract,
+	18: divide,
+}
+
+// compositeFast is the specialized implementation of Composite that operates
+// directly on the pixel slices with integer math. It reports false if
+// the image types are not supported. The rectangle r must already be clipped.
+func compositeFast(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point, mode int, opacity uint8) bool {
+	var (
+		pix     []uint8
+		offset  func(x, y int) int
+		premult bool
+	)
+
+	switch dst := dst.(type) {
+	case *image.NRGBA:
+		pix, offset = dst.Pix, dst.PixOffset
+	case *image.RGBA:
+		pix, offset, premult = dst.Pix, dst.PixOffset, true
+	default:
+		return false
+	}
+
+	row, ok := newRowReader(src, r.Dx())
+	if !ok {
+		return false
+	}
+
+	// premultiplied backdrops are blended in a non-premultiplied scratch row
+	var scratch []uint8
+	if premult {
+		scratch = make([]uint8, 4*r.Dx())
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		s := row(sp.X, sp.Y+y-r.Min.Y)
+		i := offset(r.Min.X, y)
+		d := pix[i : i+4*r.Dx() : i+4*r.Dx()]
+
+		if !premult {
+			compositeRow(d, s, mode, opacity)
+			continue
+		}
+
+		for j := 0; j < len(d); j += 4 {
+			c := unpremultiply(d[j], d[j+1], d[j+2], d[j+3])
+			scratch[j], scratch[j+1], scratch[j+2], scratch[j+3] = c.R, c.G, c.B, c.A
+		}
+		compositeRow(scratch, s, mode, opacity)
+		for j := 0; j < len(d); j += 4 {
+			c := color.NRGBA{scratch[j], scratch[j+1], scratch[j+2], scratch[j+3]}
+			d[j], d[j+1], d[j+2], d[j+3] = premultiply(c)
+		}
+	}
+
+	return true
+}
+
+// compositeRow composites the non-premultiplied source pixels s onto
+// the non-premultiplied backdrop pixels d in place, the same way as composite.
+func compositeRow(d, s []uint8, mode int, opacity uint8) {
+	if mode == 0 {
+		compositeRowNormal(d, s, opacity)
+		return
+	}
+
+	ch, fn := channelModes[mode], Modes[mode]
+
+	for j := 0; j < len(d); j += 4 {
+		b := color.NRGBA{d[j], d[j+1], d[j+2], d[j+3]}
+		c := color.NRGBA{s[j], s[j+1], s[j+2], s[j+3]}
+
+		var r color.NRGBA
+		switch {
+		case b.A == 0:
+			r = normal(b, c, opacity)
+		case ch != nil:
+			x := color.NRGBA{
+				R: uint8(ch(int32(b.R), int32(c.R))),
+				G: uint8(ch(int32(b.G), int32(c.G))),
+				B: uint8(ch(int32(b.B), int32(c.B))),
+				A: c.A,
+			}
+			r = compositeBlended(b, c, x, opacity)
+		default:
+			r = compositeBlended(b, c, fn(b, c), opacity)
+		}
+
+		d[j], d[j+1], d[j+2], d[j+3] = r.R, r.G, r.B, r.A
+	}
+}
+
+// compositeRowNormal is compositeRow for the normal blend mode.
+// It is the same as normal.
+func compositeRowNormal(d, s []uint8, opacity uint8) {
+	op := int32(opacity)
+
+	for j := 0; j < len(d); j += 4 {
+		b, c := d[j:j+4:j+4], s[j:j+4:j+4]
+
+		if b[3] == 0 {
+			b[0], b[1], b[2], b[3] = c[0], c[1], c[2], uint8(mul(int32(c[3]), op))
+			continue
+		} else if c[3] == 0 {
+			continue
+		}
+
+		ba := int32(b[3])
+		sa := mul(int32(c[3]), op)
+		ra := sa + ba - mul(ba, sa)
+
+		b[0] = uint8(int32(b[0]) + (int32(c[0])-int32(b[0]))*sa/ra)
+		b[1] = uint8(int32(b[1]) + (int32(c[1])-int32(b[1]))*sa/ra)
+		b[2] = uint8(int32(b[2]) + (int32(c[2])-int32(b[2]))*sa/ra)
+		b[3] = uint8(ra)
+	}
+}
+
+// rowReader returns the non-premultiplied pixels of the row of an image
+// that starts at x, y.
+type rowReader func(x, y int) []uint8
+
+// newRowReader returns a rowReader of rows of n pixels of img,
+// or false if img is not one of the supported concrete image types.
+// Rows of *image.NRGBA images are read without copying.
+func newRowReader(img image.Image, n int) (rowReader, bool) {
+	switch img := img.(type) {
+	case *image.NRGBA:
+		return func(x, y int) []uint8 {
+			i := img.PixOffset(x, y)
+			return img.Pix[i : i+4*n : i+4*n]
+		}, true
+	case *image.RGBA:
+		row := make([]uint8, 4*n)
+		return func(x, y int) []uint8 {
+			s := img.Pix[img.PixOffset(x, y):]
+			for j := 0; j < len(row); j += 4 {
+				c := unpremultiply(s[j], s[j+1], s[j+2], s[j+3])
+				row[j], row[j+1], row[j+2], row[j+3] = c.R, c.G, c.B, c.A
+			}
+			return row
+		}, true
+	case *image.Paletted:
+		var palette [256]color.NRGBA
+		for j, c := range img.Palette {
+			if j == len(palette) {
+				break
+			}
+			palette[j] = color.NRGBAModel.Convert(c).(color.NRGBA)
+		}
+		row := make([]uint8, 4*n)
+		return func(x, y int) []uint8 {
+			s := img.Pix[img.PixOffset(x, y):]
+			for j := 0; j < len(row); j += 4 {
+				c := palette[s[j/4]]
+				row[j], row[j+1], row[j+2], row[j+3] = c.R, c.G, c.B, c.A
+			}
+			return row
+		}, true
+	}
+	return nil, false
+}
+
+// unpremultiply converts an 8-bit premultiplied color to color.NRGBA
+// the same way as color.NRGBAModel.
+func unpremultiply(r, g, b, a uint8) color.NRGBA {
+	switch a {
+	case 0:
+		return color.NRGBA{}
+	case 0xff:
+		return color.NRGBA{r, g, b, a}
+	}
+	a16 := uint32(a) * 0x101
+	return color.NRGBA{
+		R: uint8((uint32(r) * 0x101 * 0xffff / a16) >> 8),
+		G: uint8((uint32(g) * 0x101 * 0xffff / a16) >> 8),
+		B: uint8((uint32(b) * 0x101 * 0xffff / a16) >> 8),
+		A: a,
+	}
+}
+
+// premultiply converts c to an 8-bit premultiplied color
+// the same way as color.RGBAModel.
+func premultiply(c color.NRGBA) (r, g, b, a uint8) {
+	a16 := uint32(c.A) * 0x101
+	return uint8((uint32(c.R) * 0x101 * a16 / 0xffff) >> 8),
+		uint8((uint32(c.G) * 0x101 * a16 / 0xffff) >> 8),
+		uint8((uint32(c.B) * 0x101 * a16 / 0xffff) >> 8),
+		c.A
+}
@@ -0,0 +1,71 @@
+package blend_test
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/askeladdk/aseprite"
+	"github.com/askeladdk/aseprite/internal/blend"
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+// TestBlendGolden compares the compositing of every blend mode at several
+// opacities with golden images exported from Aseprite by testfiles/blendmodes.sh.
+func TestBlendGolden(t *testing.T) {
+	f, err := os.Open("../../testfiles/blendmodes.aseprite")
+	require.NoError(t, err)
+	defer f.Close()
+
+	doc, err := aseprite.ReadDocument(f)
+	require.NoError(t, err)
+
+	for i, fr := range doc.Frames {
+		backdrop := fr.Cels[0].Image
+
+		for _, c := range fr.Cels[1:] {
+			mode := doc.Layers[c.Layer].BlendMode
+			name := fmt.Sprintf("../../testfiles/blendmodes/%s-%d.png", mode, i)
+
+			want, err := pngDecode(name)
+			if os.IsNotExist(err) {
+				t.Fatalf("golden image %s is missing, run testfiles/blendmodes.sh", name)
+			}
+
+			t.Run(fmt.Sprintf("%s/%d", mode, c.Opacity), func(t *testing.T) {
+				require.NoError(t, err)
+
+				r := image.Rect(0, 0, doc.Width, doc.Height)
+				require.True(t, want.Bounds() == r, "bounds", want.Bounds())
+
+				got := image.NewNRGBA(r)
+				blend.Composite(got, backdrop.Bounds(), backdrop, backdrop.Bounds().Min, 0, 255)
+				blend.Composite(got, c.Image.Bounds(), c.Image, c.Image.Bounds().Min, int(mode), c.Opacity)
+
+				for y := r.Min.Y; y < r.Max.Y; y++ {
+					for x := r.Min.X; x < r.Max.X; x++ {
+						g := got.NRGBAAt(x, y)
+						w := color.NRGBAModel.Convert(want.At(x, y)).(color.NRGBA)
+						// the color of transparent pixels does not matter
+						if g.A == 0 && w.A == 0 {
+							continue
+						}
+						require.True(t, g == w, "pixel", x, y, "got", g, "want", w)
+					}
+				}
+			})
+		}
+	}
+}
+
+func pngDecode(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
@@ -0,0 +1,309 @@
+package aseprite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+// JSONFormat enumerates the ways frames are listed in a JSON data file.
+type JSONFormat uint8
+
+const (
+	// JSONHash lists frames in an object keyed by frame name.
+	JSONHash JSONFormat = iota
+
+	// JSONArray lists frames in an array with a filename field.
+	JSONArray
+)
+
+// JSONOptions specifies how a JSON data file is written.
+type JSONOptions struct {
+	// Format is the way frames are listed.
+	Format JSONFormat
+
+	// Image is the file name of the atlas image written to meta.image.
+	Image string
+
+	// Title is used in the default frame names, which are
+	// "{Title} {frame}.aseprite", or "{Title}.aseprite" for single frame sprites.
+	Title string
+
+	// FrameName returns the name of frame i.
+	// It overrides the default frame names if it is not nil.
+	FrameName func(i int) string
+}
+
+func (o *JSONOptions) frameName(spr *Aseprite, i int) string {
+	var title string
+	if o != nil {
+		if o.FrameName != nil {
+			return o.FrameName(i)
+		}
+		title = o.Title
+	}
+
+	if len(spr.Frames) == 1 {
+		return title + ".aseprite"
+	}
+	return title + " " + strconv.Itoa(i) + ".aseprite"
+}
+
+var errMultiplePages = errors.New("aseprite: JSON data file requires a single atlas page")
+
+// EncodeJSON writes the frames, tags, layers and slices of spr to w
+// in the JSON data file format of Aseprite's sprite sheet export.
+// The data file describes a single image, so spr must have a single atlas page.
+// A nil opts uses the default options.
+func EncodeJSON(w io.Writer, spr *Aseprite, opts *JSONOptions) error {
+	if len(spr.Pages) > 1 {
+		return errMultiplePages
+	}
+
+	frames := make([]jsonFrame, len(spr.Frames))
+	for i, fr := range spr.Frames {
+		frames[i] = jsonFrame{
+			Filename:         opts.frameName(spr, i),
+			Frame:            jsonRectOf(fr.Bounds),
+			Trimmed:          fr.Offset != image.Point{} || fr.Bounds.Size() != fr.Size,
+			SpriteSourceSize: jsonRectOf(fr.Bounds.Sub(fr.Bounds.Min).Add(fr.Offset)),
+			SourceSize:       jsonSize{fr.Size.X, fr.Size.Y},
+			Duration:         fr.Duration.Milliseconds(),
+		}
+	}
+
+	doc := jsonDoc{
+		Meta: jsonMeta{
+			App:       "https://www.aseprite.org/",
+			Version:   "1.3",
+			Format:    "RGBA8888",
+			Size:      jsonSize{spr.Bounds().Dx(), spr.Bounds().Dy()},
+			Scale:     "1",
+			FrameTags: jsonTagsOf(spr.Tags),
+			Layers:    jsonLayersOf(spr.Layers),
+			Slices:    jsonSlicesOf(spr.Slices),
+		},
+	}
+
+	if opts != nil {
+		doc.Meta.Image = opts.Image
+	}
+
+	if _, ok := spr.Image.(*image.Paletted); ok {
+		doc.Meta.Format = "I8"
+	}
+
+	if opts != nil && opts.Format == JSONArray {
+		doc.Frames = frames
+	} else {
+		doc.Frames = jsonFrameHash(frames)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	return enc.Encode(doc)
+}
+
+type jsonDoc struct {
+	Frames interface{} `json:"frames"`
+	Meta   jsonMeta    `json:"meta"`
+}
+
+type jsonMeta struct {
+	App       string      `json:"app"`
+	Version   string      `json:"version"`
+	Image     string      `json:"image"`
+	Format    string      `json:"format"`
+	Size      jsonSize    `json:"size"`
+	Scale     string      `json:"scale"`
+	FrameTags []jsonTag   `json:"frameTags"`
+	Layers    []jsonLayer `json:"layers"`
+	Slices    []jsonSlice `json:"slices"`
+}
+
+type jsonRect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+func jsonRectOf(r image.Rectangle) jsonRect {
+	return jsonRect{r.Min.X, r.Min.Y, r.Dx(), r.Dy()}
+}
+
+type jsonSize struct {
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type jsonPoint struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type jsonFrame struct {
+	Filename         string   `json:"filename"`
+	Frame            jsonRect `json:"frame"`
+	Rotated          bool     `json:"rotated"`
+	Trimmed          bool     `json:"trimmed"`
+	SpriteSourceSize jsonRect `json:"spriteSourceSize"`
+	SourceSize       jsonSize `json:"sourceSize"`
+	Duration         int64    `json:"duration"`
+}
+
+// jsonFrameHash encodes frames as an object keyed by file name
+// in the order of the frames.
+type jsonFrameHash []jsonFrame
+
+// jsonHashFrame is a jsonFrame without the file name.
+type jsonHashFrame struct {
+	Filename         string   `json:"-"`
+	Frame            jsonRect `json:"frame"`
+	Rotated          bool     `json:"rotated"`
+	Trimmed          bool     `json:"trimmed"`
+	SpriteSourceSize jsonRect `json:"spriteSourceSize"`
+	SourceSize       jsonSize `json:"sourceSize"`
+	Duration         int64    `json:"duration"`
+}
+
+func (h jsonFrameHash) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, fr := range h {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		name, err := json.Marshal(fr.Filename)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(jsonHashFrame(fr))
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+type jsonTag struct {
+	Name      string `json:"name"`
+	From      int    `json:"from"`
+	To        int    `json:"to"`
+	Direction string `json:"direction"`
+	Repeat    string `json:"repeat,omitempty"`
+	Color     string `json:"color,omitempty"`
+}
+
+func jsonTagsOf(tags []Tag) []jsonTag {
+	jtags := make([]jsonTag, len(tags))
+	for i, t := range tags {
+		jtags[i] = jsonTag{
+			Name:      t.Name,
+			From:      int(t.Lo),
+			To:        int(t.Hi),
+			Direction: t.LoopDirection.String(),
+			Color:     jsonColor(t.Color),
+		}
+		if t.Repeat > 0 {
+			jtags[i].Repeat = strconv.Itoa(int(t.Repeat))
+		}
+	}
+	return jtags
+}
+
+type jsonLayer struct {
+	Name      string `json:"name"`
+	Group     string `json:"group,omitempty"`
+	Opacity   *int   `json:"opacity,omitempty"`
+	BlendMode string `json:"blendMode,omitempty"`
+	Color     string `json:"color,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+func jsonLayersOf(layers []Layer) []jsonLayer {
+	jlayers := make([]jsonLayer, len(layers))
+	for i, l := range layers {
+		jlayers[i] = jsonLayer{
+			Name:  l.Name,
+			Color: jsonColor(l.Color),
+			Data:  string(l.Data),
+		}
+		if l.Parent >= 0 && l.Parent < len(layers) {
+			jlayers[i].Group = layers[l.Parent].Name
+		}
+		// group layers have no pixels to blend
+		if !l.Group {
+			opacity := int(l.Opacity)
+			jlayers[i].Opacity = &opacity
+			jlayers[i].BlendMode = l.BlendMode.String()
+		}
+	}
+	return jlayers
+}
+
+type jsonSlice struct {
+	Name  string         `json:"name"`
+	Color string         `json:"color"`
+	Data  string         `json:"data,omitempty"`
+	Keys  []jsonSliceKey `json:"keys"`
+}
+
+type jsonSliceKey struct {
+	Frame  int        `json:"frame"`
+	Bounds jsonRect   `json:"bounds"`
+	Center *jsonRect  `json:"center,omitempty"`
+	Pivot  *jsonPoint `json:"pivot,omitempty"`
+}
+
+// jsonSlicesOf converts the slice keys to the slices of the JSON data file.
+func jsonSlicesOf(slices []Slice) []jsonSlice {
+	jslices := []jsonSlice{}
+	for _, keys := range groupSlices(slices) {
+		js := jsonSlice{
+			Name:  keys[0].Name,
+			Color: jsonColor(keys[0].Color),
+			Data:  string(keys[0].Data),
+		}
+
+		for _, s := range keys {
+			key := jsonSliceKey{
+				Frame:  s.Frame,
+				Bounds: jsonRectOf(s.Bounds),
+			}
+			if s.hasCenter() {
+				center := jsonRectOf(s.Center)
+				key.Center = &center
+			}
+			if s.hasPivot() {
+				key.Pivot = &jsonPoint{s.Pivot.X, s.Pivot.Y}
+			}
+			js.Keys = append(js.Keys, key)
+		}
+
+		jslices = append(jslices, js)
+	}
+	return jslices
+}
+
+// jsonColor formats c as #rrggbbaa, or returns the empty string if c is nil.
+func jsonColor(c color.Color) string {
+	if c == nil {
+		return ""
+	}
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
@@ -0,0 +1,172 @@
+package aseprite
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/slime_grayscale.aseprite")
+	require.NoError(t, err)
+
+	spr, err := ReadWithOptions(bytes.NewReader(raw), &Options{Layout: LayoutHorizontal, Trim: true})
+	require.NoError(t, err)
+
+	type rect struct{ X, Y, W, H int }
+	type frame struct {
+		Filename         string
+		Frame            rect
+		Trimmed          bool
+		SpriteSourceSize rect
+		SourceSize       struct{ W, H int }
+		Duration         int
+	}
+	type doc struct {
+		Frames json.RawMessage
+		Meta   struct {
+			Image     string
+			Format    string
+			Size      struct{ W, H int }
+			FrameTags []struct {
+				Name      string
+				From, To  int
+				Direction string
+			}
+			Layers []struct {
+				Name      string
+				Opacity   int
+				BlendMode string
+				Data      string
+			}
+			Slices []struct {
+				Name  string
+				Color string
+				Keys  []struct {
+					Frame  int
+					Bounds rect
+					Center *rect
+					Pivot  *struct{ X, Y int }
+				}
+			}
+		}
+	}
+
+	for _, format := range []JSONFormat{JSONHash, JSONArray} {
+		var b bytes.Buffer
+		err := EncodeJSON(&b, spr, &JSONOptions{Format: format, Image: "slime.png", Title: "slime"})
+		require.NoError(t, err)
+
+		var d doc
+		require.NoError(t, json.Unmarshal(b.Bytes(), &d))
+
+		var frames []frame
+		if format == JSONArray {
+			require.NoError(t, json.Unmarshal(d.Frames, &frames))
+		} else {
+			var hash map[string]frame
+			require.NoError(t, json.Unmarshal(d.Frames, &hash))
+			for i := range spr.Frames {
+				name := "slime " + strconv.Itoa(i) + ".aseprite"
+				fr, ok := hash[name]
+				require.True(t, ok, "frame name", name)
+				fr.Filename = name
+				frames = append(frames, fr)
+			}
+
+			// hash keys are in frame order
+			for i := 1; i < len(spr.Frames); i++ {
+				prev := strings.Index(b.String(), `"slime `+strconv.Itoa(i-1)+`.aseprite"`)
+				next := strings.Index(b.String(), `"slime `+strconv.Itoa(i)+`.aseprite"`)
+				require.True(t, prev < next, "key order", i)
+			}
+		}
+
+		require.True(t, len(frames) == len(spr.Frames), "frames", len(frames))
+		for i, fr := range frames {
+			sf := spr.Frames[i]
+			require.True(t, fr.Filename == "slime "+strconv.Itoa(i)+".aseprite", "filename", fr.Filename)
+			require.True(t, fr.Frame == rect{sf.Bounds.Min.X, sf.Bounds.Min.Y, sf.Bounds.Dx(), sf.Bounds.Dy()}, "frame", i)
+			require.True(t, fr.Trimmed, "trimmed", i)
+			require.True(t, fr.SpriteSourceSize == rect{sf.Offset.X, sf.Offset.Y, sf.Bounds.Dx(), sf.Bounds.Dy()}, "sprite source size", i)
+			require.True(t, fr.SourceSize.W == 32 && fr.SourceSize.H == 64, "source size", i)
+			require.True(t, int64(fr.Duration) == sf.Duration.Milliseconds(), "duration", i)
+		}
+
+		m := d.Meta
+		require.True(t, m.Image == "slime.png" && m.Format == "RGBA8888", "meta")
+		require.True(t, m.Size.W == spr.Bounds().Dx() && m.Size.H == spr.Bounds().Dy(), "size")
+
+		require.True(t, len(m.FrameTags) == 2, "tags")
+		require.True(t, m.FrameTags[0].Name == "Up" && m.FrameTags[0].From == 0 && m.FrameTags[0].To == 3, "tag 0")
+		require.True(t, m.FrameTags[0].Direction == "pingpong" && m.FrameTags[1].Direction == "forward", "tag directions")
+
+		require.True(t, len(m.Layers) == 2, "layers")
+		require.True(t, m.Layers[1].Name == "stretch" && m.Layers[1].Opacity == 255 && m.Layers[1].BlendMode == "normal", "layer 1")
+		require.True(t, m.Layers[0].Data == "first layer", "layer data")
+
+		require.True(t, len(m.Slices) == 2, "slices")
+		s := m.Slices[0]
+		require.True(t, s.Name == "Slice 1" && s.Color == "#0000ffff" && len(s.Keys) == 1, "slice 1")
+		require.True(t, s.Keys[0].Bounds == rect{8, 32, 8, 8}, "slice bounds")
+		require.True(t, s.Keys[0].Center != nil && *s.Keys[0].Center == rect{1, 1, 6, 6}, "slice center")
+		require.True(t, s.Keys[0].Pivot != nil && s.Keys[0].Pivot.X == 4 && s.Keys[0].Pivot.Y == 4, "slice pivot")
+		require.True(t, m.Slices[1].Keys[0].Center == nil && m.Slices[1].Keys[0].Pivot == nil, "slice 2")
+	}
+}
+
+func TestEncodeJSONMultiplePages(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/slime_paletted.aseprite")
+	require.NoError(t, err)
+
+	spr, err := ReadWithOptions(bytes.NewReader(raw), &Options{Layout: LayoutPacked, MaxSize: image.Pt(64, 64)})
+	require.NoError(t, err)
+	require.True(t, EncodeJSON(&bytes.Buffer{}, spr, nil) == errMultiplePages, "error")
+}
+
+func TestEncodeJSONSlices(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	spr := Aseprite{
+		Image:  img,
+		Pages:  []image.Image{img},
+		Frames: []Frame{{Bounds: img.Bounds(), Size: image.Pt(4, 4)}, {Bounds: img.Bounds(), Size: image.Pt(4, 4)}},
+		Slices: []Slice{
+			// two slices with the same name
+			{Name: "hit", ID: 0, Frame: 0, Bounds: image.Rect(0, 0, 1, 1)},
+			{Name: "hit", ID: 1, Frame: 1, Bounds: image.Rect(1, 1, 2, 2)},
+			// one slice with two keys and a pivot at the origin
+			{Name: "feet", ID: 2, Frame: 0, Bounds: image.Rect(0, 0, 4, 4), HasPivot: true},
+			{Name: "feet", ID: 2, Frame: 1, Bounds: image.Rect(0, 0, 4, 4), HasPivot: true},
+		},
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, EncodeJSON(&b, &spr, nil))
+
+	var m struct {
+		Meta struct {
+			Slices []struct {
+				Name string
+				Keys []struct {
+					Center *struct{ X, Y, W, H int }
+					Pivot  *struct{ X, Y int }
+				}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &m))
+
+	slices := m.Meta.Slices
+	require.True(t, len(slices) == 3, "slices", len(slices))
+	require.True(t, len(slices[0].Keys) == 1 && len(slices[1].Keys) == 1, "separate slices")
+	require.True(t, len(slices[2].Keys) == 2, "keys")
+	for _, k := range slices[2].Keys {
+		require.True(t, k.Pivot != nil && *k.Pivot == struct{ X, Y int }{} && k.Center == nil, "pivot", k)
+	}
+}
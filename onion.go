@@ -0,0 +1,121 @@
+package aseprite
+
+import (
+	"errors"
+	"image"
+	"image/color"
+
+	"github.com/askeladdk/aseprite/internal/blend"
+)
+
+// Default onion skin opacities of Aseprite.
+const (
+	defaultOnionSkinOpacity     = 68
+	defaultOnionSkinOpacityStep = 28
+)
+
+// OnionSkinOptions specifies how OnionSkin draws the neighboring frames.
+// The zero value draws the frame without neighbors.
+type OnionSkinOptions struct {
+	// Prev is the number of frames before the frame to draw.
+	Prev int
+
+	// Next is the number of frames after the frame to draw.
+	Next int
+
+	// Opacity is the opacity of the nearest neighboring frames.
+	// Zero uses the default of Aseprite, which is 68.
+	Opacity uint8
+
+	// OpacityStep is how much the opacity decreases for every frame
+	// farther away. Zero uses the default of Aseprite, which is 28.
+	OpacityStep uint8
+
+	// PrevTint and NextTint are optional colors that tint
+	// the frames before and after the frame.
+	// The tint is mixed into the frame pixels by the alpha of the tint color.
+	PrevTint, NextTint color.Color
+
+	// Behind draws the neighboring frames behind the frame
+	// instead of over it.
+	Behind bool
+}
+
+func (o *OnionSkinOptions) opacity(distance int) uint8 {
+	base, step := defaultOnionSkinOpacity, defaultOnionSkinOpacityStep
+	if o.Opacity != 0 {
+		base = int(o.Opacity)
+	}
+	if o.OpacityStep != 0 {
+		step = int(o.OpacityStep)
+	}
+
+	if op := base - (distance-1)*step; op > 0 {
+		return uint8(op)
+	}
+	return 0
+}
+
+// OnionSkin returns the untrimmed image of frame i composited with
+// the frames before and after it, as the onion skin of Aseprite.
+// Neighboring frames are drawn with an opacity that decreases
+// with their distance to the frame, and farther frames are drawn first.
+// Frames outside of the sprite are skipped.
+//
+// The frames are taken from the atlas, which holds the frames as composited
+// by Read, so the layers are not blended again. Trimmed frames are drawn
+// at their Offset in a transparent frame of their Size and deduplicated frames
+// share their atlas image, so the result is the same for all Options.
+func OnionSkin(spr *Aseprite, i int, opts *OnionSkinOptions) (*image.NRGBA, error) {
+	if i < 0 || i >= len(spr.Frames) {
+		return nil, errors.New("aseprite: frame out of range")
+	}
+
+	if opts == nil {
+		opts = &OnionSkinOptions{}
+	}
+
+	img := spriteFrame(spr, i)
+	if opts.Behind {
+		img = image.NewNRGBA(img.Bounds())
+	}
+
+	n := opts.Prev
+	if opts.Next > n {
+		n = opts.Next
+	}
+
+	for k := n; k > 0; k-- {
+		opacity := opts.opacity(k)
+		if opacity == 0 {
+			continue
+		}
+		if k <= opts.Prev && i-k >= 0 {
+			drawOnionSkin(img, spriteFrame(spr, i-k), opts.PrevTint, opacity)
+		}
+		if k <= opts.Next && i+k < len(spr.Frames) {
+			drawOnionSkin(img, spriteFrame(spr, i+k), opts.NextTint, opacity)
+		}
+	}
+
+	if opts.Behind {
+		drawOnionSkin(img, spriteFrame(spr, i), nil, 255)
+	}
+
+	return img, nil
+}
+
+// drawOnionSkin tints src and composites it onto dst with the opacity.
+func drawOnionSkin(dst, src *image.NRGBA, tint color.Color, opacity uint8) {
+	if tint != nil {
+		c := color.NRGBAModel.Convert(tint).(color.NRGBA)
+		a := int(c.A)
+		for j := 0; j < len(src.Pix); j += 4 {
+			src.Pix[j+0] = uint8(int(src.Pix[j+0]) + (int(c.R)-int(src.Pix[j+0]))*a/255)
+			src.Pix[j+1] = uint8(int(src.Pix[j+1]) + (int(c.G)-int(src.Pix[j+1]))*a/255)
+			src.Pix[j+2] = uint8(int(src.Pix[j+2]) + (int(c.B)-int(src.Pix[j+2]))*a/255)
+		}
+	}
+
+	blend.Composite(dst, dst.Bounds(), src, src.Bounds().Min, int(BlendNormal), opacity)
+}
@@ -0,0 +1,95 @@
+package aseprite
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func TestOnionSkin(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}
+
+	// frame k has a white pixel at x=k and its color at x=3
+	atlas := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	spr := Aseprite{Image: atlas, Pages: []image.Image{atlas}}
+	for k, c := range colors {
+		atlas.SetNRGBA(k, k, white)
+		atlas.SetNRGBA(3, k, c)
+		spr.Frames = append(spr.Frames, Frame{Bounds: image.Rect(0, k, 4, k+1), Size: image.Pt(4, 1)})
+	}
+
+	for _, tt := range []struct {
+		Name   string
+		Frame  int
+		Opts   *OnionSkinOptions
+		Pixels []color.NRGBA
+	}{
+		{"none", 1, nil, []color.NRGBA{{}, white, {}, colors[1]}},
+		{"neighbors", 1, &OnionSkinOptions{Prev: 1, Next: 1, Behind: true}, []color.NRGBA{
+			{255, 255, 255, 68}, white, {255, 255, 255, 68}, colors[1],
+		}},
+		{"decreasing", 2, &OnionSkinOptions{Prev: 2, Behind: true}, []color.NRGBA{
+			{255, 255, 255, 40}, {255, 255, 255, 68}, white, colors[2],
+		}},
+		{"opacity", 2, &OnionSkinOptions{Prev: 2, Opacity: 100, OpacityStep: 100, Behind: true}, []color.NRGBA{
+			{}, {255, 255, 255, 100}, white, colors[2],
+		}},
+		{"tint", 1, &OnionSkinOptions{Prev: 1, Next: 1, PrevTint: color.NRGBA{255, 0, 0, 255}, NextTint: color.NRGBA{0, 0, 255, 255}, Behind: true}, []color.NRGBA{
+			{255, 0, 0, 68}, white, {0, 0, 255, 68}, colors[1],
+		}},
+		// neighboring frames are drawn over the frame by default
+		{"over", 0, &OnionSkinOptions{Next: 1}, []color.NRGBA{
+			white, {255, 255, 255, 68}, {}, {187, 68, 0, 255},
+		}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			img, err := OnionSkin(&spr, tt.Frame, tt.Opts)
+			require.NoError(t, err)
+			require.True(t, img.Bounds() == image.Rect(0, 0, 4, 1), "bounds", img.Bounds())
+			for x, want := range tt.Pixels {
+				got := img.NRGBAAt(x, 0)
+				require.True(t, got == want, "pixel", x, got)
+			}
+		})
+	}
+
+	_, err := OnionSkin(&spr, 3, nil)
+	require.True(t, err != nil, "frame out of range")
+}
+
+func TestOnionSkinTrim(t *testing.T) {
+	// frames with transparent borders, and frames 0 and 2 are the same
+	raw := makeTestFile(4, 8, 6, []testLayer{{
+		Opacity: 255,
+		Pixel: func(frame, x, y int) color.NRGBA {
+			k := frame % 2
+			if frame == 3 {
+				k = 3
+			}
+			if x < 1+k || x > 5 || y < 2 || y > 4-k/2 {
+				return color.NRGBA{}
+			}
+			return color.NRGBA{uint8(x * 30), uint8(y * 40), uint8(k * 80), 255}
+		},
+	}})
+
+	plain, err := Read(bytes.NewReader(raw))
+	require.NoError(t, err)
+	trimmed, err := ReadWithOptions(bytes.NewReader(raw), &Options{Trim: true, Dedupe: true})
+	require.NoError(t, err)
+	require.True(t, trimmed.Frames[1].Bounds.Size() != trimmed.Frames[1].Size, "trimmed")
+	require.True(t, trimmed.Frames[0].Bounds == trimmed.Frames[2].Bounds, "deduplicated")
+
+	opts := OnionSkinOptions{Prev: 2, Next: 2, PrevTint: color.NRGBA{255, 0, 0, 128}}
+	for i := range plain.Frames {
+		want, err := OnionSkin(plain, i, &opts)
+		require.NoError(t, err)
+		got, err := OnionSkin(trimmed, i, &opts)
+		require.NoError(t, err)
+		require.True(t, got.Bounds() == want.Bounds() && bytes.Equal(got.Pix, want.Pix), "frame", i)
+	}
+}
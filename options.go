@@ -0,0 +1,105 @@
+package aseprite
+
+import (
+	"image"
+	"runtime"
+)
+
+// Layout enumerates the strategies to arrange frames on the atlas.
+type Layout uint8
+
+const (
+	// LayoutPowerOfTwo arranges frames in a grid whose number of columns
+	// and rows are powers of two. The grid is wider than it is high
+	// unless the frames are wider than they are high.
+	LayoutPowerOfTwo Layout = iota
+
+	// LayoutHorizontal arranges frames in a single row.
+	LayoutHorizontal
+
+	// LayoutVertical arranges frames in a single column.
+	LayoutVertical
+
+	// LayoutColumns arranges frames in a grid with a fixed number of columns.
+	LayoutColumns
+
+	// LayoutTagRows arranges the frames of each tag on a separate row.
+	// Frames that belong to multiple tags are placed in the row of the first tag.
+	// Frames that do not belong to any tag are placed on the last row.
+	LayoutTagRows
+
+	// LayoutSquare arranges frames in the grid that
+	// makes the atlas as close to a square as possible.
+	LayoutSquare
+
+	// LayoutPacked packs frames as tightly as possible using the MaxRects
+	// algorithm. Frames that do not fit on a page of Options.MaxSize
+	// are packed on additional pages.
+	LayoutPacked
+)
+
+// Options specifies how a sprite is decoded.
+// The zero value decodes a sprite the same way as Read.
+type Options struct {
+	// Parallelism is the maximum number of goroutines used to decode cels
+	// and to composite frames. Zero or negative uses runtime.GOMAXPROCS.
+	Parallelism int
+
+	// Layout is the strategy to arrange frames on the atlas.
+	Layout Layout
+
+	// Columns is the number of columns of LayoutColumns.
+	// Zero or negative is treated as one column.
+	Columns int
+
+	// MaxSize is the maximum size of an atlas page of LayoutPacked.
+	// A zero dimension is unbounded.
+	MaxSize image.Point
+
+	// PowerOfTwo rounds the dimensions of atlas pages up to powers of two.
+	// For LayoutPacked, MaxSize is rounded down to powers of two.
+	PowerOfTwo bool
+
+	// BorderPadding is the number of transparent pixels
+	// around the edges of every atlas page.
+	BorderPadding int
+
+	// Spacing is the number of transparent pixels between frames.
+	Spacing int
+
+	// Extrude is the number of times the edge pixels of every frame are
+	// repeated outward, to prevent neighboring frames from bleeding
+	// into each other when the atlas is sampled with filtering.
+	// Frame.Bounds does not include the extruded pixels.
+	Extrude int
+
+	// Dedupe stores identical frame images only once in the atlas.
+	// The Frame.Bounds of identical frames are then the same.
+	// Deduplication requires DecodeConfigWithOptions to decode the entire image.
+	Dedupe bool
+
+	// Trim crops every frame to the bounds of its pixels that are not
+	// fully transparent. Frame.Offset and Frame.Size describe
+	// where the trimmed frame image is located in the untrimmed frame.
+	// Trimming requires DecodeConfigWithOptions to decode the entire image.
+	Trim bool
+
+	// ChunkHandlers decode chunks of custom or unsupported types.
+	// The handler of a chunk type is called for every chunk of that type
+	// in file order, in addition to the decoding done by the package.
+	// The values returned by the handlers are stored in Aseprite.ChunkValues.
+	ChunkHandlers map[ChunkType]ChunkHandler
+}
+
+func (o *Options) parallelism() int {
+	if o == nil || o.Parallelism <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return o.Parallelism
+}
+
+// wholeFrames reports whether the frames must be composited
+// before the atlas is laid out.
+func (o *Options) wholeFrames() bool {
+	return o != nil && (o.Trim || o.Dedupe)
+}
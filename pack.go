@@ -0,0 +1,202 @@
+package aseprite
+
+import (
+	"errors"
+	"image"
+	"math"
+	"sort"
+)
+
+var errFrameTooLarge = errors.New("aseprite: frame does not fit in the maximum atlas size")
+
+// maxRects packs rectangles into a bin using the MaxRects algorithm
+// with the best short side fit heuristic.
+// See: Jukka Jylänki, A Thousand Ways to Pack the Bin.
+type maxRects struct {
+	free []image.Rectangle
+	used image.Rectangle
+}
+
+func newMaxRects(w, h int) *maxRects {
+	return &maxRects{
+		free: []image.Rectangle{image.Rect(0, 0, w, h)},
+	}
+}
+
+// insert finds a place for a rectangle of the given size
+// and reports false if there is none.
+func (m *maxRects) insert(size image.Point) (image.Rectangle, bool) {
+	best, bestShort, bestLong := image.Rectangle{}, math.MaxInt, math.MaxInt
+
+	for _, fr := range m.free {
+		dx, dy := fr.Dx()-size.X, fr.Dy()-size.Y
+		if dx < 0 || dy < 0 {
+			continue
+		}
+		short, long := dx, dy
+		if short > long {
+			short, long = long, short
+		}
+		if short < bestShort || (short == bestShort && long < bestLong) {
+			best = image.Rectangle{Min: fr.Min, Max: fr.Min.Add(size)}
+			bestShort, bestLong = short, long
+		}
+	}
+
+	if bestShort == math.MaxInt {
+		return image.Rectangle{}, false
+	}
+
+	m.place(best)
+	return best, true
+}
+
+// place splits all free rectangles that overlap r.
+func (m *maxRects) place(r image.Rectangle) {
+	if r.Empty() {
+		return
+	}
+
+	m.used = m.used.Union(r)
+
+	free := m.free[:0:0]
+	for _, fr := range m.free {
+		if !fr.Overlaps(r) {
+			free = append(free, fr)
+			continue
+		}
+		if r.Min.X > fr.Min.X {
+			free = append(free, image.Rect(fr.Min.X, fr.Min.Y, r.Min.X, fr.Max.Y))
+		}
+		if r.Max.X < fr.Max.X {
+			free = append(free, image.Rect(r.Max.X, fr.Min.Y, fr.Max.X, fr.Max.Y))
+		}
+		if r.Min.Y > fr.Min.Y {
+			free = append(free, image.Rect(fr.Min.X, fr.Min.Y, fr.Max.X, r.Min.Y))
+		}
+		if r.Max.Y < fr.Max.Y {
+			free = append(free, image.Rect(fr.Min.X, r.Max.Y, fr.Max.X, fr.Max.Y))
+		}
+	}
+
+	// remove free rectangles that are contained by another one
+	m.free = free[:0]
+	for i, a := range free {
+		contained := false
+		for j, b := range free {
+			if i != j && a.In(b) && (a != b || i > j) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			m.free = append(m.free, a)
+		}
+	}
+}
+
+// packRects packs rectangles of the given sizes into as few pages as needed.
+// Pages are at most maxSize large. A zero dimension of maxSize is unbounded.
+// It returns the bounds of every page, and the bounds and page index
+// of every rectangle.
+func packRects(sizes []image.Point, maxSize image.Point) (pages, rects []image.Rectangle, pageOf []int, err error) {
+	// Pack large rectangles first.
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := sizes[order[i]], sizes[order[j]]
+		if a.Y != b.Y {
+			return a.Y > b.Y
+		}
+		return a.X > b.X
+	})
+
+	// Dimensions without a maximum size get one that fits all rectangles.
+	binw, binh := unboundedBinSize(sizes)
+	if maxSize.X > 0 {
+		binw = maxSize.X
+	}
+	if maxSize.Y > 0 {
+		binh = maxSize.Y
+	}
+
+	rects = make([]image.Rectangle, len(sizes))
+	pageOf = make([]int, len(sizes))
+
+	// Empty rectangles take no space.
+	nonempty := order[:0]
+	for _, i := range order {
+		if sizes[i].X > 0 && sizes[i].Y > 0 {
+			nonempty = append(nonempty, i)
+		}
+	}
+	order = nonempty
+
+	for len(order) > 0 {
+		m := newMaxRects(binw, binh)
+		rest := order[:0]
+		for _, i := range order {
+			r, ok := m.insert(sizes[i])
+			if !ok {
+				rest = append(rest, i)
+				continue
+			}
+			rects[i], pageOf[i] = r, len(pages)
+		}
+
+		if len(rest) == len(order) {
+			return nil, nil, nil, errFrameTooLarge
+		}
+
+		pages = append(pages, image.Rectangle{Max: m.used.Max})
+		order = rest
+	}
+
+	if len(pages) == 0 {
+		pages = append(pages, image.Rectangle{})
+	}
+
+	return pages, rects, pageOf, nil
+}
+
+// unboundedBinSize returns a bin size that fits all rectangles of the given
+// sizes on a single page and that is roughly square.
+func unboundedBinSize(sizes []image.Point) (w, h int) {
+	var area, maxw int
+	for _, sz := range sizes {
+		area += sz.X * sz.Y
+		h += sz.Y
+		if sz.X > maxw {
+			maxw = sz.X
+		}
+	}
+
+	// The bin is high enough to stack all rectangles, so that they always fit.
+	// Pages are cropped to the area that is used after packing.
+	w = int(math.Ceil(math.Sqrt(float64(area))))
+	if w < maxw {
+		w = maxw
+	}
+
+	return w, h
+}
+
+// floorPowerOfTwo returns the largest power of two less than or equal to n.
+func floorPowerOfTwo(n int) int {
+	p := 1
+	for p*2 <= n {
+		p *= 2
+	}
+	return p
+}
+
+// ceilPowerOfTwo returns the smallest power of two greater than or equal to n.
+func ceilPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p *= 2
+	}
+	return p
+}
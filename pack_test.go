@@ -0,0 +1,84 @@
+package aseprite
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func TestPackRects(t *testing.T) {
+	sizes := []image.Point{
+		{30, 20}, {10, 40}, {25, 25}, {8, 8}, {0, 0}, {40, 10}, {16, 30}, {5, 12}, {20, 20}, {12, 5},
+	}
+
+	for _, tt := range []struct {
+		Name    string
+		MaxSize image.Point
+	}{
+		{"unbounded", image.Point{}},
+		{"max_width", image.Pt(48, 0)},
+		{"pages", image.Pt(50, 50)},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			pages, rects, pageOf, err := packRects(sizes, tt.MaxSize)
+			require.NoError(t, err)
+			require.True(t, len(rects) == len(sizes) && len(pageOf) == len(sizes), "lengths")
+
+			for _, p := range pages {
+				if tt.MaxSize.X > 0 {
+					require.True(t, p.Dx() <= tt.MaxSize.X, "page width", p)
+				}
+				if tt.MaxSize.Y > 0 {
+					require.True(t, p.Dy() <= tt.MaxSize.Y, "page height", p)
+				}
+			}
+
+			for i, r := range rects {
+				require.True(t, r.Size() == sizes[i], "size", i, r)
+				require.True(t, r.In(pages[pageOf[i]]), "outside page", i, r)
+				for j := 0; j < i; j++ {
+					require.True(t, pageOf[i] != pageOf[j] || !r.Overlaps(rects[j]), "overlap", i, j)
+				}
+			}
+		})
+	}
+
+	pages, _, _, err := packRects(sizes, image.Pt(50, 50))
+	require.NoError(t, err)
+	require.True(t, len(pages) > 1, "expected multiple pages", len(pages))
+
+	_, _, _, err = packRects(sizes, image.Pt(32, 32))
+	require.True(t, err == errFrameTooLarge, "expected error", err)
+}
+
+func TestLayoutPacked(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/slime_paletted.aseprite")
+	require.NoError(t, err)
+
+	opts := Options{Layout: LayoutPacked, MaxSize: image.Pt(100, 100), PowerOfTwo: true}
+	spr, err := ReadWithOptions(bytes.NewReader(raw), &opts)
+	require.NoError(t, err)
+	require.True(t, len(spr.Pages) == 5, "pages", len(spr.Pages))
+	require.True(t, spr.Image == spr.Pages[0], "first page")
+
+	conf, err := DecodeConfigWithOptions(bytes.NewReader(raw), &opts)
+	require.NoError(t, err)
+	require.True(t, conf.Width == spr.Bounds().Dx() && conf.Height == spr.Bounds().Dy(), "config size")
+
+	for i, fr := range spr.Frames {
+		page := spr.Pages[fr.Page].Bounds()
+		require.True(t, fr.Bounds.In(page), "frame outside page", i)
+		require.True(t, page.Dx() <= 64 && page.Dy() <= 64, "page size", i)
+		require.True(t, page.Dx()&(page.Dx()-1) == 0 && page.Dy()&(page.Dy()-1) == 0, "power of two", i)
+		for j := 0; j < i; j++ {
+			require.True(t, fr.Page != spr.Frames[j].Page || !fr.Bounds.Overlaps(spr.Frames[j].Bounds), "frames overlap", i, j)
+		}
+	}
+
+	opts = Options{Layout: LayoutPacked, MaxSize: image.Pt(16, 16)}
+	_, err = ReadWithOptions(bytes.NewReader(raw), &opts)
+	require.True(t, err == errFrameTooLarge, "expected error", err)
+}
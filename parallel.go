@@ -0,0 +1,54 @@
+package aseprite
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// parallel calls work for every i in [0, n) using at most workers goroutines.
+// The worker index w in [0, workers) identifies the calling goroutine,
+// so that work can use per-goroutine scratch buffers.
+// The first error stops the remaining work and is returned.
+func parallel(n, workers int, work func(w, i int) error) error {
+	if workers > n {
+		workers = n
+	}
+
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := work(0, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		wg   sync.WaitGroup
+		next int64 = -1
+		once sync.Once
+		err  error
+		stop int32
+	)
+
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				if e := work(w, i); e != nil {
+					once.Do(func() { err = e })
+					atomic.StoreInt32(&stop, 1)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	return err
+}
@@ -8,6 +8,8 @@ import (
 	"image"
 	"image/color"
 	"io"
+
+	"github.com/askeladdk/aseprite/internal/blend"
 )
 
 func skipString(raw []byte) []byte {
@@ -163,9 +165,14 @@ func (f *file) initLayers() error {
 				return err
 			}
 
+			// layer opacity is only valid if the header flag is set
+			if f.flags&1 == 0 {
+				l.opacity = 255
+			}
+
 			if i < len(chunks)-1 {
 				if ch2 := chunks[i+1]; ch2.typ == 0x2020 {
-					l.data, _ = parseUserData(ch2.raw)
+					l.data, l.color = parseUserData(ch2.raw)
 				}
 			}
 
@@ -181,73 +188,116 @@ func (f *file) initLayers() error {
 	return nil
 }
 
-func (f *file) parseChunk2005(frame int, raw []byte) (*cel, error) {
-	layer := binary.LittleEndian.Uint16(raw)
-	xpos := int(binary.LittleEndian.Uint16(raw[2:]))
-	ypos := int(binary.LittleEndian.Uint16(raw[4:]))
-	opacity := raw[6]
-	celtype := binary.LittleEndian.Uint16(raw[7:])
+// celLayer returns the layer index of a cel chunk and reports
+// whether the layer is rendered.
+func (f *file) celLayer(raw []byte) (int, bool) {
+	layer := int(binary.LittleEndian.Uint16(raw))
 
 	// invisible layer
 	if f.layers[layer].flags&1 == 0 {
-		return nil, nil
+		return layer, false
 	}
 
 	// reference layer
 	if f.layers[layer].flags&64 != 0 {
-		return nil, nil
+		return layer, false
 	}
 
-	raw = raw[16:]
+	return layer, true
+}
+
+func celType(raw []byte) uint16 {
+	return binary.LittleEndian.Uint16(raw[7:])
+}
 
-	opacity = byte((int(opacity) * int(f.layers[layer].opacity)) / 255)
+func (f *file) parseChunk2005(frame int, raw []byte) error {
+	layer, visible := f.celLayer(raw)
+	if !visible {
+		return nil
+	}
 
-	switch celtype {
-	case 0: // uncompressed image
-		width := int(binary.LittleEndian.Uint16(raw))
-		height := int(binary.LittleEndian.Uint16(raw[2:]))
-		pix := raw[4:]
-		bounds := image.Rect(xpos, ypos, xpos+width, ypos+height)
-		cel := f.makeCel(f, bounds, opacity, pix)
-		f.frames[frame].cels[layer] = cel
-	case 1: // linked cel
-		srcFrame := int(binary.LittleEndian.Uint16(raw))
+	opacity := blend.MulOpacity(raw[6], f.layers[layer].opacity)
+
+	if celType(raw) == 1 { // linked cel
+		srcFrame := int(binary.LittleEndian.Uint16(raw[16:]))
 		srcCel := f.frames[srcFrame].cels[layer]
 		f.frames[frame].cels[layer] = srcCel
+		return nil
+	}
+
+	bounds, pix, err := celImage(raw)
+	if err != nil {
+		return err
+	}
+
+	f.frames[frame].cels[layer] = f.makeCel(f, bounds, opacity, pix)
+	return nil
+}
+
+// celImage returns the bounds and the uncompressed pixels of an image cel.
+func celImage(raw []byte) (image.Rectangle, []byte, error) {
+	xpos := int(int16(binary.LittleEndian.Uint16(raw[2:])))
+	ypos := int(int16(binary.LittleEndian.Uint16(raw[4:])))
+	celtype := celType(raw)
+
+	raw = raw[16:]
+	width := int(binary.LittleEndian.Uint16(raw))
+	height := int(binary.LittleEndian.Uint16(raw[2:]))
+	bounds := image.Rect(xpos, ypos, xpos+width, ypos+height)
+
+	switch celtype {
+	case 0: // uncompressed image
+		return bounds, raw[4:], nil
 	case 2: // compressed image
-		width := int(binary.LittleEndian.Uint16(raw))
-		height := int(binary.LittleEndian.Uint16(raw[2:]))
 		zr, err := zlib.NewReader(bytes.NewReader(raw[4:]))
 		if err != nil {
-			return nil, err
+			return image.Rectangle{}, nil, err
 		}
 		pix, err := io.ReadAll(zr)
 		if err != nil {
-			return nil, err
+			return image.Rectangle{}, nil, err
 		}
-		bounds := image.Rect(xpos, ypos, xpos+width, ypos+height)
-		cel := f.makeCel(f, bounds, opacity, pix)
-		f.frames[frame].cels[layer] = cel
+		return bounds, pix, nil
 	default:
-		return nil, errors.New("unsupported cel type")
+		return image.Rectangle{}, nil, errors.New("unsupported cel type")
 	}
-
-	return &f.frames[frame].cels[layer], nil
 }
 
-func (f *file) initCels() error {
+func (f *file) initCels(workers int) error {
+	// Image cels do not depend on each other and are decoded in parallel.
+	err := parallel(len(f.frames), workers, func(_, i int) error {
+		for _, ch := range f.frames[i].chunks {
+			if ch.typ == 0x2005 && celType(ch.raw) != 1 {
+				if err := f.parseChunk2005(i, ch.raw); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Linked cels refer to cels in preceding frames
+	// and are resolved in order together with the user data.
 	for i := range f.frames {
 		chunks := f.frames[i].chunks
 		for j, ch := range chunks {
-			if ch.typ == 0x2005 {
-				cel, err := f.parseChunk2005(i, ch.raw)
-				if err != nil {
+			if ch.typ != 0x2005 {
+				continue
+			}
+
+			if celType(ch.raw) == 1 {
+				if err := f.parseChunk2005(i, ch.raw); err != nil {
 					return err
-				} else if cel != nil && j < (len(chunks)-1) {
-					// user data chunk
-					if ch2 := chunks[j+1]; ch2.typ == 0x2020 {
-						cel.data, _ = parseUserData(ch2.raw)
-					}
+				}
+			}
+
+			if layer, visible := f.celLayer(ch.raw); visible && j < (len(chunks)-1) {
+				// user data chunk
+				if ch2 := chunks[j+1]; ch2.typ == 0x2020 {
+					f.frames[i].cels[layer].data, _ = parseUserData(ch2.raw)
 				}
 			}
 		}
@@ -261,6 +311,7 @@ func parseTag(t *Tag, raw []byte) []byte {
 	t.Hi = binary.LittleEndian.Uint16(raw[2:])
 	t.LoopDirection = LoopDirection(raw[4])
 	t.Repeat = binary.LittleEndian.Uint16(raw[5:])
+	t.Color = color.NRGBA{raw[13], raw[14], raw[15], 255}
 	t.Name = parseString(raw[17:])
 	return raw[19+len(t.Name):]
 }
@@ -283,7 +334,7 @@ func (f *file) buildTags() []Tag {
 }
 
 func parseSlice(s *Slice, flags uint32, raw []byte) []byte {
-	// framenum := binary.LittleEndian.Uint32(raw)
+	s.Frame = int(binary.LittleEndian.Uint32(raw))
 	x := int32(binary.LittleEndian.Uint32(raw[4:]))
 	y := int32(binary.LittleEndian.Uint32(raw[8:]))
 	w := binary.LittleEndian.Uint32(raw[12:])
@@ -318,6 +369,7 @@ func parseSlice(s *Slice, flags uint32, raw []byte) []byte {
 
 func (f *file) buildSlices() (slices []Slice) {
 	chunks := f.frames[0].chunks
+	id := 0
 	for i, chunk := range chunks {
 		if chunk.typ == 0x2022 {
 			ofs := len(slices)
@@ -329,8 +381,7 @@ func (f *file) buildSlices() (slices []Slice) {
 			// parse each slice
 			raw = raw[14+len(name):]
 			for i := 0; len(raw) > 0 && i < nslices; i++ {
-				var s Slice
-				s.Name = name
+				s := Slice{Name: name, ID: id, HasCenter: flags&1 != 0, HasPivot: flags&2 != 0}
 				raw = parseSlice(&s, flags, raw)
 				slices = append(slices, s)
 			}
@@ -346,8 +397,37 @@ func (f *file) buildSlices() (slices []Slice) {
 					}
 				}
 			}
+
+			id++
 		}
 	}
 
 	return
 }
+
+// groupSlices groups consecutive slice keys with the same ID and name
+// and increasing frames into slices.
+func groupSlices(slices []Slice) [][]Slice {
+	var groups [][]Slice
+	for i, s := range slices {
+		if i > 0 {
+			prev := slices[i-1]
+			if s.ID == prev.ID && s.Name == prev.Name && s.Frame > prev.Frame {
+				groups[len(groups)-1] = append(groups[len(groups)-1], s)
+				continue
+			}
+		}
+		groups = append(groups, []Slice{s})
+	}
+	return groups
+}
+
+// hasCenter reports whether the center of the slice key is set.
+func (s *Slice) hasCenter() bool {
+	return s.HasCenter || !s.Center.Empty()
+}
+
+// hasPivot reports whether the pivot of the slice key is set.
+func (s *Slice) hasPivot() bool {
+	return s.HasPivot || s.Pivot != (image.Point{})
+}
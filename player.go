@@ -0,0 +1,204 @@
+package aseprite
+
+import "time"
+
+// minDuration is the shortest frame duration that Aseprite allows.
+const minDuration = time.Millisecond
+
+// Player plays the animation of a tag by advancing through its frames
+// as time passes.
+//
+// The animation is played in passes. Forward and reverse tags play all frames
+// in every pass. Ping-pong tags change direction after every pass and do not
+// repeat the frame where the previous pass ended.
+// The animation stops after Tag.Repeat passes, or loops forever if it is zero.
+//
+// Tags nested in the tag play their own animations within every pass,
+// as in Aseprite 1.3. A nested tag is entered at its first frame in the
+// direction of the pass and plays all its repetitions, or once if it repeats
+// forever, before the pass continues after its frames.
+type Player struct {
+	// OnLoop is called when a pass ends and the next pass begins.
+	OnLoop func()
+
+	// OnFinish is called when the last pass ends.
+	// The player then stays on the last frame.
+	OnFinish func()
+
+	spr     *Aseprite
+	intro   [][]int
+	cycle   [][]int
+	pass    []int
+	npass   int
+	index   int
+	elapsed time.Duration
+	done    bool
+}
+
+// NewPlayer returns a player of the animation of a tag of spr.
+// If tag is nil, the animation plays all frames forward forever.
+func NewPlayer(spr *Aseprite, tag *Tag) (*Player, error) {
+	t, err := spriteTag(spr, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	p := Player{spr: spr}
+	p.intro, p.cycle = spr.tagPasses(t, tag != nil)
+	p.Reset()
+	return &p, nil
+}
+
+// Reset restarts the animation from the first frame.
+func (p *Player) Reset() {
+	p.npass, p.index, p.elapsed, p.done = 0, 0, 0, false
+	p.pass = p.passAt(0)
+}
+
+// Frame returns the index of the current frame in the sprite.
+func (p *Player) Frame() int {
+	return p.pass[p.index]
+}
+
+// Done reports whether the animation has finished.
+func (p *Player) Done() bool {
+	return p.done
+}
+
+// Update advances the animation by dt.
+// Frames shorter than a millisecond last a millisecond, as in Aseprite.
+func (p *Player) Update(dt time.Duration) {
+	if p.done || dt <= 0 {
+		return
+	}
+
+	p.elapsed += dt
+	for !p.done {
+		d := p.spr.frameDuration(p.Frame())
+		if p.elapsed < d {
+			return
+		}
+		p.elapsed -= d
+		p.next()
+	}
+}
+
+// next advances to the next frame.
+func (p *Player) next() {
+	if p.index++; p.index < len(p.pass) {
+		return
+	}
+
+	if len(p.cycle) == 0 && p.npass+1 >= len(p.intro) {
+		p.index, p.elapsed, p.done = len(p.pass)-1, 0, true
+		if p.OnFinish != nil {
+			p.OnFinish()
+		}
+		return
+	}
+
+	if p.npass++; p.npass >= len(p.intro)+len(p.cycle) {
+		p.npass -= len(p.cycle)
+	}
+	p.pass, p.index = p.passAt(p.npass), 0
+	if p.OnLoop != nil {
+		p.OnLoop()
+	}
+}
+
+// passAt returns the frames that pass n of the animation plays,
+// where the passes of the cycle follow the passes of the intro.
+func (p *Player) passAt(n int) []int {
+	if n < len(p.intro) {
+		return p.intro[n]
+	}
+	return p.cycle[n-len(p.intro)]
+}
+
+// tagPass returns the frames that pass n of the animation of t plays.
+// It is the same for every pass of forward and reverse tags.
+// Ping-pong tags alternate direction and every pass after the first
+// skips the frame where the previous pass ended.
+func tagPass(t Tag, n int) []int {
+	lo, hi := int(t.Lo), int(t.Hi)
+
+	reverse := passReverse(t, n)
+	if n > 0 && lo < hi && (t.LoopDirection == PingPong || t.LoopDirection == PingPongReverse) {
+		if reverse {
+			hi--
+		} else {
+			lo++
+		}
+	}
+
+	pass := make([]int, 0, hi-lo+1)
+	for i := lo; i <= hi; i++ {
+		if reverse {
+			pass = append(pass, lo+hi-i)
+		} else {
+			pass = append(pass, i)
+		}
+	}
+	return pass
+}
+
+// passReverse reports whether pass n of the animation of t plays backward.
+func passReverse(t Tag, n int) bool {
+	switch t.LoopDirection {
+	case Reverse:
+		return true
+	case PingPong:
+		return n%2 == 1
+	case PingPongReverse:
+		return n%2 == 0
+	}
+	return false
+}
+
+// nestedPass returns the frames that pass n of the animation of t plays
+// when the tags nested in t play their own animations.
+// A nested tag is entered at its first frame in the direction of the pass,
+// plays all its repetitions, and the pass continues after its frames.
+// Nested tags that repeat forever play once.
+func (spr *Aseprite) nestedPass(t Tag, n int) []int {
+	pass := tagPass(t, n)
+	inner := spr.innerTags(t)
+	if len(inner) == 0 {
+		return pass
+	}
+
+	reverse := passReverse(t, n)
+
+	var seq []int
+	for k := 0; k < len(pass); k++ {
+		c, ok := enteredTag(inner, pass[k], reverse)
+		if !ok {
+			seq = append(seq, pass[k])
+			continue
+		}
+
+		repeat := int(c.Repeat)
+		if repeat == 0 {
+			repeat = 1
+		}
+		for m := 0; m < repeat; m++ {
+			seq = append(seq, spr.nestedPass(c, m)...)
+		}
+
+		for k+1 < len(pass) && pass[k+1] >= int(c.Lo) && pass[k+1] <= int(c.Hi) {
+			k++
+		}
+	}
+	return seq
+}
+
+// enteredTag returns the first tag of tags that is entered at frame i
+// when playing forward or backward.
+func enteredTag(tags []Tag, i int, reverse bool) (Tag, bool) {
+	for _, t := range tags {
+		if (!reverse && int(t.Lo) == i) || (reverse && int(t.Hi) == i) {
+			return t, true
+		}
+	}
+	return Tag{}, false
+}
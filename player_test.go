@@ -0,0 +1,137 @@
+package aseprite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func testSprite(durations ...time.Duration) *Aseprite {
+	spr := Aseprite{Frames: make([]Frame, len(durations))}
+	for i, d := range durations {
+		spr.Frames[i].Duration = d
+	}
+	return &spr
+}
+
+func TestPlayer(t *testing.T) {
+	const ms = time.Millisecond
+	spr := testSprite(100*ms, 100*ms, 100*ms, 100*ms, 100*ms)
+
+	for _, tt := range []struct {
+		Name   string
+		Tag    Tag
+		Frames []int
+		Loops  int
+		Done   bool
+	}{
+		{"forward", Tag{Lo: 1, Hi: 3}, []int{1, 2, 3, 1, 2, 3, 1}, 2, false},
+		{"forward_twice", Tag{Lo: 1, Hi: 3, Repeat: 2}, []int{1, 2, 3, 1, 2, 3, 3, 3}, 1, true},
+		{"reverse", Tag{Lo: 1, Hi: 3, LoopDirection: Reverse}, []int{3, 2, 1, 3, 2}, 1, false},
+		{"reverse_once", Tag{Lo: 1, Hi: 3, LoopDirection: Reverse, Repeat: 1}, []int{3, 2, 1, 1}, 0, true},
+		{"pingpong", Tag{Lo: 1, Hi: 3, LoopDirection: PingPong}, []int{1, 2, 3, 2, 1, 2, 3, 2, 1}, 4, false},
+		{"pingpong_thrice", Tag{Lo: 1, Hi: 3, LoopDirection: PingPong, Repeat: 3}, []int{1, 2, 3, 2, 1, 2, 3, 3}, 2, true},
+		{"pingpong_reverse", Tag{Lo: 0, Hi: 2, LoopDirection: PingPongReverse}, []int{2, 1, 0, 1, 2, 1}, 2, false},
+		{"pingpong_single", Tag{Lo: 4, Hi: 4, LoopDirection: PingPong, Repeat: 2}, []int{4, 4, 4}, 1, true},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			p, err := NewPlayer(spr, &tt.Tag)
+			require.NoError(t, err)
+
+			var loops, finished int
+			p.OnLoop = func() { loops++ }
+			p.OnFinish = func() { finished++ }
+
+			for i, want := range tt.Frames {
+				require.True(t, p.Frame() == want, "frame", i, p.Frame())
+				p.Update(100 * ms)
+			}
+
+			require.True(t, loops == tt.Loops, "loops", loops)
+			require.True(t, p.Done() == tt.Done, "done")
+			if tt.Done {
+				require.True(t, finished == 1, "finished", finished)
+			}
+		})
+	}
+}
+
+func TestPlayerDurations(t *testing.T) {
+	const ms = time.Millisecond
+	spr := testSprite(100*ms, 50*ms, 0, 200*ms)
+
+	p, err := NewPlayer(spr, nil)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		Delta time.Duration
+		Frame int
+	}{
+		{99 * ms, 0},
+		{1 * ms, 1},
+		{49 * ms, 1},
+		{1 * ms, 2},
+		// frames last at least a millisecond
+		{1 * ms, 3},
+		// large deltas skip frames and loop
+		{300 * ms, 1},
+	} {
+		p.Update(tt.Delta)
+		require.True(t, p.Frame() == tt.Frame, "frame", tt.Delta, p.Frame())
+	}
+
+	p.Reset()
+	require.True(t, p.Frame() == 0 && !p.Done(), "reset")
+
+	_, err = NewPlayer(spr, &Tag{Lo: 2, Hi: 4})
+	require.True(t, err != nil, "tag out of range")
+}
+
+func TestPlayerTagFrames(t *testing.T) {
+	// finite animations play the same frames as TagFrames
+	spr := testSprite(time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond)
+	spr.Tags = []Tag{{Lo: 3, Hi: 4, LoopDirection: Reverse, Repeat: 2}}
+
+	for _, dir := range []LoopDirection{Forward, Reverse, PingPong, PingPongReverse} {
+		tag := Tag{Lo: 2, Hi: 5, LoopDirection: dir, Repeat: 4}
+		p, err := NewPlayer(spr, &tag)
+		require.NoError(t, err)
+
+		frames := spr.TagFrames(tag)
+		for i, want := range frames {
+			require.True(t, p.Frame() == want && !p.Done(), "frame", dir, i, p.Frame())
+			p.Update(time.Millisecond)
+		}
+		require.True(t, p.Done(), "done", dir)
+	}
+}
+
+func TestPlayerNested(t *testing.T) {
+	const ms = time.Millisecond
+	spr := testSprite(100*ms, 100*ms, 100*ms, 100*ms)
+	spr.Tags = []Tag{
+		{Name: "outer", Lo: 0, Hi: 3, Repeat: 1},
+		{Name: "inner", Lo: 1, Hi: 2, LoopDirection: Reverse, Repeat: 2},
+	}
+
+	for _, tt := range []struct {
+		Name   string
+		Tag    *Tag
+		Frames []int
+	}{
+		{"outer", &spr.Tags[0], []int{0, 2, 1, 2, 1, 3, 3}},
+		// without a tag the nested tags are not played
+		{"all", nil, []int{0, 1, 2, 3, 0}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			p, err := NewPlayer(spr, tt.Tag)
+			require.NoError(t, err)
+
+			for i, want := range tt.Frames {
+				require.True(t, p.Frame() == want, "frame", i, p.Frame())
+				p.Update(100 * ms)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package aseprite
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+)
+
+// Atlas holds the frames of many sprites on shared atlas pages.
+type Atlas struct {
+	// Pages lists all atlas pages.
+	// Pages are *GrayAlpha images if all sprites are grayscale,
+	// *image.Paletted images if all sprites are indexed with the same palette,
+	// and *image.RGBA images otherwise.
+	Pages []image.Image
+
+	// Sprites lists the sprites in the order they were given.
+	// Their Image and Pages are the shared atlas pages and
+	// their frames are located on the shared atlas pages.
+	// Tags and user data are the same as those of the original sprites.
+	// Slices have a key for every frame whose Bounds are moved from
+	// sprite coordinates to the atlas page of the frame.
+	Sprites []*Aseprite
+}
+
+// ReadAtlas decodes the Aseprite images from rs and
+// arranges all their frames on shared atlas pages using the given options.
+// A nil opts uses the default options.
+func ReadAtlas(rs []io.Reader, opts *Options) (*Atlas, error) {
+	var readOpts Options
+	if opts != nil {
+		readOpts.Parallelism = opts.Parallelism
+	}
+
+	sprites := make([]*Aseprite, len(rs))
+	for i, r := range rs {
+		spr, err := ReadWithOptions(r, &readOpts)
+		if err != nil {
+			return nil, err
+		}
+		sprites[i] = spr
+	}
+
+	return PackSprites(sprites, opts)
+}
+
+// PackSprites arranges the frames of all sprites on shared atlas pages
+// using the given options. The sprites are not modified.
+// Grid layouts arrange the frames as if they belonged to a single sprite
+// that has the tags of all sprites.
+// A nil opts uses the default options.
+func PackSprites(sprites []*Aseprite, opts *Options) (*Atlas, error) {
+	newPage := sharedPageFunc(sprites)
+
+	var (
+		frames    []image.Image
+		srcs      []image.Rectangle
+		tags      []Tag
+		frameSize image.Point
+	)
+
+	for _, spr := range sprites {
+		for _, t := range spr.Tags {
+			if int(t.Hi)+len(frames) > math.MaxUint16 {
+				return nil, errors.New("aseprite: too many frames to pack")
+			}
+			t.Lo += uint16(len(frames))
+			t.Hi += uint16(len(frames))
+			tags = append(tags, t)
+		}
+
+		for _, fr := range spr.Frames {
+			// Frame images are stored in the type of the pages.
+			// Paletted frames keep their color indices.
+			img := newPage(image.Rectangle{Max: fr.Bounds.Size()})
+			drawAtlasFrame(img, img.Bounds(), spr.Pages[fr.Page], fr.Bounds.Min)
+			frames = append(frames, img)
+
+			src := img.Bounds()
+			if opts != nil && opts.Trim {
+				src = opaqueBounds(img)
+			}
+			srcs = append(srcs, src)
+
+			if fr.Size.X > frameSize.X {
+				frameSize.X = fr.Size.X
+			}
+			if fr.Size.Y > frameSize.Y {
+				frameSize.Y = fr.Size.Y
+			}
+		}
+	}
+
+	slots := frameSlots(opts, frames, srcs)
+	pagesr, framesr, pageOf, err := layoutAtlas(opts, srcs, slots, frameSize, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	atlases := make([]draw.Image, len(pagesr))
+	for i, r := range pagesr {
+		atlases[i] = newPage(r)
+	}
+
+	atlas := Atlas{
+		Pages:   drawAtlas(opts, atlases, func(_, i int) image.Image { return frames[i] }, srcs, slots, framesr, pageOf),
+		Sprites: make([]*Aseprite, len(sprites)),
+	}
+
+	i := 0
+	for j, spr := range sprites {
+		packed := *spr
+		packed.Image = atlas.Pages[0]
+		packed.Pages = atlas.Pages
+		packed.Frames = make([]Frame, len(spr.Frames))
+		for k, fr := range spr.Frames {
+			fr.Bounds = framesr[i]
+			fr.Page = pageOf[i]
+			fr.Offset = fr.Offset.Add(srcs[i].Min)
+			packed.Frames[k] = fr
+			i++
+		}
+		packed.Slices = atlasSlices(spr.Slices, packed.Frames)
+		atlas.Sprites[j] = &packed
+	}
+
+	return &atlas, nil
+}
+
+// atlasSlices returns the slice keys with a key for every frame
+// whose bounds are moved from sprite coordinates to the atlas page of the frame.
+func atlasSlices(slices []Slice, frames []Frame) []Slice {
+	var keys []Slice
+	for _, group := range groupSlices(slices) {
+		for j, key := range group {
+			// a key applies until the next key of the slice
+			end := len(frames)
+			if j+1 < len(group) && group[j+1].Frame < end {
+				end = group[j+1].Frame
+			}
+
+			for k := key.Frame; k < end; k++ {
+				if k < 0 {
+					continue
+				}
+				fr := frames[k]
+				s := key
+				s.Frame = k
+				s.Bounds = key.Bounds.Add(fr.Bounds.Min.Sub(fr.Offset))
+				keys = append(keys, s)
+			}
+		}
+	}
+	return keys
+}
+
+// sharedPageFunc returns a function that allocates atlas pages
+// that can hold the colors of all sprites.
+func sharedPageFunc(sprites []*Aseprite) func(image.Rectangle) draw.Image {
+	paletted, gray := len(sprites) > 0, len(sprites) > 0
+	var palette color.Palette
+
+	for _, spr := range sprites {
+		switch img := spr.Image.(type) {
+		case *image.Paletted:
+			if palette == nil {
+				palette = img.Palette
+			} else if !equalPalettes(palette, img.Palette) {
+				paletted = false
+			}
+			gray = false
+		case *GrayAlpha:
+			paletted = false
+		default:
+			paletted, gray = false, false
+		}
+	}
+
+	switch {
+	case paletted:
+		return func(r image.Rectangle) draw.Image { return image.NewPaletted(r, palette) }
+	case gray:
+		return func(r image.Rectangle) draw.Image { return NewGrayAlpha(r) }
+	default:
+		return func(r image.Rectangle) draw.Image { return image.NewRGBA(r) }
+	}
+}
+
+func equalPalettes(a, b color.Palette) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+package aseprite
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func TestPackSprites(t *testing.T) {
+	paletted, err := os.ReadFile("./testfiles/slime_paletted.aseprite")
+	require.NoError(t, err)
+	grayscale, err := os.ReadFile("./testfiles/slime_grayscale.aseprite")
+	require.NoError(t, err)
+	rgba := makeTestFile(3, 8, 6, gradientLayers(0))
+
+	for _, tt := range []struct {
+		Name    string
+		Files   [][]byte
+		Options Options
+		Pages   int
+	}{
+		{"mixed", [][]byte{paletted, grayscale, rgba}, Options{Layout: LayoutPacked}, 1},
+		{"paletted", [][]byte{paletted, paletted}, Options{Layout: LayoutTagRows}, 1},
+		{"grayscale", [][]byte{grayscale}, Options{Layout: LayoutPacked, Trim: true, Spacing: 1}, 1},
+		{"pages", [][]byte{paletted, rgba}, Options{Layout: LayoutPacked, MaxSize: image.Pt(64, 128)}, 3},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			var rs []io.Reader
+			var sprites []*Aseprite
+			for _, raw := range tt.Files {
+				rs = append(rs, bytes.NewReader(raw))
+				spr, err := Read(bytes.NewReader(raw))
+				require.NoError(t, err)
+				sprites = append(sprites, spr)
+			}
+
+			atlas, err := ReadAtlas(rs, &tt.Options)
+			require.NoError(t, err)
+			require.True(t, len(atlas.Pages) == tt.Pages, "pages", len(atlas.Pages))
+			require.True(t, len(atlas.Sprites) == len(sprites), "sprites")
+
+			for i, packed := range atlas.Sprites {
+				spr := sprites[i]
+				require.True(t, packed.Image == atlas.Pages[0], "image", i)
+				require.True(t, len(packed.Frames) == len(spr.Frames), "frames", i)
+				require.True(t, len(packed.Tags) == len(spr.Tags), "tags", i)
+
+				for j, fr := range packed.Frames {
+					orig := spr.Frames[j]
+					page := atlas.Pages[fr.Page]
+					require.True(t, fr.Bounds.In(page.Bounds()), "frame outside page", i, j)
+					require.True(t, fr.Size == orig.Size && fr.Duration == orig.Duration, "metadata", i, j)
+
+					for y := 0; y < orig.Size.Y; y++ {
+						for x := 0; x < orig.Size.X; x++ {
+							_, _, _, a := spr.At(orig.Bounds.Min.X+x, orig.Bounds.Min.Y+y).RGBA()
+							p := image.Pt(x, y).Sub(fr.Offset).Add(fr.Bounds.Min)
+							if !p.In(fr.Bounds) {
+								require.True(t, a == 0, "trimmed opaque pixel", i, j, x, y)
+								continue
+							}
+							r0, g0, b0, a0 := spr.At(orig.Bounds.Min.X+x, orig.Bounds.Min.Y+y).RGBA()
+							r1, g1, b1, a1 := page.At(p.X, p.Y).RGBA()
+							require.True(t, r0 == r1 && g0 == g1 && b0 == b1 && a0 == a1, "pixel", i, j, x, y)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPackSpritesPageType(t *testing.T) {
+	paletted, err := os.ReadFile("./testfiles/slime_paletted.aseprite")
+	require.NoError(t, err)
+	grayscale, err := os.ReadFile("./testfiles/slime_grayscale.aseprite")
+	require.NoError(t, err)
+
+	read := func(files ...[]byte) image.Image {
+		var rs []io.Reader
+		for _, raw := range files {
+			rs = append(rs, bytes.NewReader(raw))
+		}
+		atlas, err := ReadAtlas(rs, nil)
+		require.NoError(t, err)
+		return atlas.Pages[0]
+	}
+
+	_, ok := read(paletted, paletted).(*image.Paletted)
+	require.True(t, ok, "paletted")
+	_, ok = read(grayscale, grayscale).(*GrayAlpha)
+	require.True(t, ok, "grayscale")
+	_, ok = read(paletted, grayscale).(*image.RGBA)
+	require.True(t, ok, "mixed")
+}
+
+func TestPackSpritesDedupe(t *testing.T) {
+	raw, err := os.ReadFile("./testfiles/slime_paletted.aseprite")
+	require.NoError(t, err)
+
+	atlas, err := ReadAtlas([]io.Reader{bytes.NewReader(raw), bytes.NewReader(raw)}, &Options{Layout: LayoutPacked, Dedupe: true})
+	require.NoError(t, err)
+
+	a, b := atlas.Sprites[0], atlas.Sprites[1]
+	for i := range a.Frames {
+		require.True(t, a.Frames[i].Bounds == b.Frames[i].Bounds, "shared bounds", i)
+	}
+}
+
+func TestPackSpritesPalettedIndices(t *testing.T) {
+	// the palette has duplicate colors that draw.Draw would remap
+	palette := color.Palette{color.Transparent, color.NRGBA{255, 0, 0, 255}, color.NRGBA{255, 0, 0, 255}}
+	img := image.NewPaletted(image.Rect(0, 0, 2, 2), palette)
+	for i := range img.Pix {
+		img.Pix[i] = 2
+	}
+
+	spr := Aseprite{
+		Image:  img,
+		Pages:  []image.Image{img},
+		Frames: []Frame{{Bounds: img.Bounds(), Size: image.Pt(2, 2)}},
+	}
+
+	atlas, err := PackSprites([]*Aseprite{&spr}, &Options{Extrude: 1})
+	require.NoError(t, err)
+
+	page := atlas.Pages[0].(*image.Paletted)
+	for i, index := range page.Pix {
+		require.True(t, index == 2, "index", i, index)
+	}
+}
+
+func TestPackSpritesTooManyFrames(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	spr := Aseprite{
+		Image:  img,
+		Pages:  []image.Image{img},
+		Frames: []Frame{{Bounds: img.Bounds(), Size: image.Pt(1, 1)}},
+	}
+
+	// the tag of the second sprite would end after frame 65535
+	tagged := spr
+	tagged.Tags = []Tag{{Lo: 0xFFFF, Hi: 0xFFFF}}
+
+	_, err := PackSprites([]*Aseprite{&spr, &tagged}, nil)
+	require.True(t, err != nil, "error")
+}
+
+func TestPackSpritesSlices(t *testing.T) {
+	raw := makeTestFile(3, 8, 6, []testLayer{{
+		Opacity: 255,
+		Pixel: func(frame, x, y int) color.NRGBA {
+			if x < 2+frame || y < 1 {
+				return color.NRGBA{}
+			}
+			return color.NRGBA{uint8(x * 30), uint8(y * 40), uint8(frame * 80), 255}
+		},
+	}})
+	spr, err := Read(bytes.NewReader(raw))
+	require.NoError(t, err)
+	spr.Slices = []Slice{
+		{Name: "body", ID: 0, Frame: 0, Bounds: image.Rect(3, 2, 7, 5), Pivot: image.Pt(1, 1), HasPivot: true},
+		{Name: "body", ID: 0, Frame: 2, Bounds: image.Rect(5, 1, 8, 6), Pivot: image.Pt(1, 1), HasPivot: true},
+	}
+
+	atlas, err := PackSprites([]*Aseprite{spr, spr}, &Options{Layout: LayoutPacked, Trim: true, Spacing: 1})
+	require.NoError(t, err)
+
+	for i, packed := range atlas.Sprites {
+		require.True(t, len(packed.Slices) == 3, "keys", i, len(packed.Slices))
+		for k, s := range packed.Slices {
+			orig := spr.Slices[0]
+			if k == 2 {
+				orig = spr.Slices[1]
+			}
+			require.True(t, s.Frame == k && s.Name == "body" && s.Pivot == orig.Pivot && s.HasPivot, "key", i, k)
+			require.True(t, s.Bounds.Size() == orig.Bounds.Size(), "size", i, k)
+
+			// the slice covers the same pixels of the frame on the atlas page
+			fr, want := packed.Frames[k], spriteFrame(spr, k)
+			page := atlas.Pages[fr.Page]
+			for y := orig.Bounds.Min.Y; y < orig.Bounds.Max.Y; y++ {
+				for x := orig.Bounds.Min.X; x < orig.Bounds.Max.X; x++ {
+					p := image.Pt(x, y).Sub(orig.Bounds.Min).Add(s.Bounds.Min)
+					c := color.NRGBAModel.Convert(page.At(p.X, p.Y)).(color.NRGBA)
+					require.True(t, c == want.NRGBAAt(x, y), "pixel", i, k, x, y)
+				}
+			}
+		}
+	}
+
+	// the original sprite keeps its slices
+	require.True(t, len(spr.Slices) == 2 && spr.Slices[0].Bounds == image.Rect(3, 2, 7, 5), "original slices")
+}
@@ -0,0 +1,257 @@
+package aseprite
+
+import (
+	"sort"
+	"time"
+)
+
+// FindTag returns the first tag with the given name.
+func (spr *Aseprite) FindTag(name string) (Tag, bool) {
+	for _, t := range spr.Tags {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tag{}, false
+}
+
+// FindTags returns all tags with the given name.
+func (spr *Aseprite) FindTags(name string) []Tag {
+	var tags []Tag
+	for _, t := range spr.Tags {
+		if t.Name == name {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// TagFrames returns the frame indices that the animation of t plays in order,
+// with the tags nested in t playing their own animations as in Player.
+// Tags that repeat a number of times play all repetitions.
+// Tags that repeat forever play the returned frames and then keep
+// repeating the cycle that the returned frames end with.
+// It returns nil if the frames of t are not in the sprite.
+func (spr *Aseprite) TagFrames(t Tag) []int {
+	if _, err := spriteTag(spr, &t); err != nil {
+		return nil
+	}
+
+	intro, cycle := spr.tagLoop(t, true)
+	return append(intro, cycle...)
+}
+
+// TagDuration returns the time that it takes to play the frames of TagFrames.
+// It returns zero if the frames of t are not in the sprite.
+func (spr *Aseprite) TagDuration(t Tag) time.Duration {
+	return spr.framesDuration(spr.TagFrames(t))
+}
+
+// TagFrameAt returns the index of the frame that the animation of t shows
+// at the given time since it started.
+// Animations that repeat forever wrap around, and other animations
+// stay on their last frame after they finish.
+// It returns -1 if the frames of t are not in the sprite.
+func (spr *Aseprite) TagFrameAt(t Tag, offset time.Duration) int {
+	if _, err := spriteTag(spr, &t); err != nil {
+		return -1
+	}
+
+	intro, cycle := spr.tagLoop(t, true)
+	if offset < 0 {
+		offset = 0
+	}
+
+	if d := spr.framesDuration(intro); len(cycle) > 0 && offset >= d {
+		offset = (offset - d) % spr.framesDuration(cycle)
+		intro = cycle
+	}
+
+	for _, i := range intro {
+		if offset < spr.frameDuration(i) {
+			return i
+		}
+		offset -= spr.frameDuration(i)
+	}
+
+	return intro[len(intro)-1]
+}
+
+// tagPasses returns the passes that the animation of t plays once
+// followed by the passes that it repeats forever.
+// The cycle is empty if the animation ends.
+// The tags nested in t play their own animations if nested is true.
+// It is the playback order of Player, TagFrames, GIF and EncodeAPNG.
+func (spr *Aseprite) tagPasses(t Tag, nested bool) (intro, cycle [][]int) {
+	// passes after the first alternate between two passes,
+	// which are shared by all repetitions
+	var passes [3][]int
+	pass := func(n int) []int {
+		if n > 2 {
+			n = 1 + (n-1)%2
+		}
+		if passes[n] == nil {
+			if nested {
+				passes[n] = spr.nestedPass(t, n)
+			} else {
+				passes[n] = tagPass(t, n)
+			}
+		}
+		return passes[n]
+	}
+
+	switch {
+	case t.Repeat > 0:
+		intro = make([][]int, t.Repeat)
+		for n := range intro {
+			intro[n] = pass(n)
+		}
+		return intro, nil
+	case t.LoopDirection != PingPong && t.LoopDirection != PingPongReverse:
+		return nil, [][]int{pass(0)}
+	}
+
+	// the second and third passes of ping-pong animations repeat forever
+	return [][]int{pass(0)}, [][]int{pass(1), pass(2)}
+}
+
+// tagLoop returns the frames that the animation of t plays once
+// followed by the frames that it repeats forever.
+// The cycle is empty if the animation ends.
+func (spr *Aseprite) tagLoop(t Tag, nested bool) (intro, cycle []int) {
+	introPasses, cyclePasses := spr.tagPasses(t, nested)
+	for _, pass := range introPasses {
+		intro = append(intro, pass...)
+	}
+	for _, pass := range cyclePasses {
+		cycle = append(cycle, pass...)
+	}
+
+	// move the end of the intro into the cycle while they match
+	// so that plain ping-pong animations are a single cycle
+	for len(intro) > 0 && len(cycle) > 0 && intro[len(intro)-1] == cycle[len(cycle)-1] {
+		cycle = append([]int{intro[len(intro)-1]}, cycle[:len(cycle)-1]...)
+		intro = intro[:len(intro)-1]
+	}
+	return intro, cycle
+}
+
+// period returns the shortest start of seq that makes seq when repeated.
+func period(seq []int) []int {
+	for n := 1; n < len(seq); n++ {
+		if len(seq)%n != 0 {
+			continue
+		}
+
+		repeats := true
+		for i := n; i < len(seq) && repeats; i++ {
+			repeats = seq[i] == seq[i-n]
+		}
+		if repeats {
+			return seq[:n]
+		}
+	}
+	return seq
+}
+
+// framesDuration returns the total duration of frames.
+func (spr *Aseprite) framesDuration(frames []int) time.Duration {
+	var total time.Duration
+	for _, i := range frames {
+		total += spr.frameDuration(i)
+	}
+	return total
+}
+
+// frameDuration returns the duration of frame i,
+// which is at least a millisecond as in Aseprite.
+func (spr *Aseprite) frameDuration(i int) time.Duration {
+	if d := spr.Frames[i].Duration; d >= minDuration {
+		return d
+	}
+	return minDuration
+}
+
+// TagNode is a tag in the tree of nested tags of a sprite.
+type TagNode struct {
+	// Index is the index of the tag in Aseprite.Tags.
+	Index int
+
+	// Tag is the tag.
+	Tag Tag
+
+	// Children are the tags nested in the tag ordered by their first frame.
+	Children []*TagNode
+}
+
+// TagTree returns the tags of spr as a tree of nested tags
+// ordered by their first frame.
+// A tag is nested in the smallest tag whose frames contain its frames,
+// or the first of them if there are several.
+// Tags with the same frames and tags that overlap without
+// containing each other are siblings.
+func (spr *Aseprite) TagTree() []*TagNode {
+	nodes := make([]*TagNode, len(spr.Tags))
+	for i, t := range spr.Tags {
+		nodes[i] = &TagNode{Index: i, Tag: t}
+	}
+
+	var roots []*TagNode
+	for i, t := range spr.Tags {
+		parent := -1
+		for j, u := range spr.Tags {
+			if nests(u, t) && (parent < 0 || u.Hi-u.Lo < spr.Tags[parent].Hi-spr.Tags[parent].Lo) {
+				parent = j
+			}
+		}
+
+		if parent < 0 {
+			roots = append(roots, nodes[i])
+		} else {
+			nodes[parent].Children = append(nodes[parent].Children, nodes[i])
+		}
+	}
+
+	sortTagNodes(roots)
+	for _, n := range nodes {
+		sortTagNodes(n.Children)
+	}
+	return roots
+}
+
+// sortTagNodes sorts nodes by their first frame.
+func sortTagNodes(nodes []*TagNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Tag.Lo < nodes[j].Tag.Lo
+	})
+}
+
+// innerTags returns the tags of spr that are nested directly in t.
+func (spr *Aseprite) innerTags(t Tag) []Tag {
+	var inner []Tag
+	for _, c := range spr.Tags {
+		if !nests(t, c) {
+			continue
+		}
+
+		direct := true
+		for _, u := range spr.Tags {
+			if nests(t, u) && nests(u, c) {
+				direct = false
+				break
+			}
+		}
+
+		if direct {
+			inner = append(inner, c)
+		}
+	}
+	return inner
+}
+
+// nests reports whether the frames of outer contain the frames of inner
+// and are not the same.
+func nests(outer, inner Tag) bool {
+	return outer.Lo <= inner.Lo && inner.Hi <= outer.Hi &&
+		(outer.Lo != inner.Lo || outer.Hi != inner.Hi)
+}
@@ -0,0 +1,189 @@
+package aseprite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/askeladdk/aseprite/internal/require"
+)
+
+func TestFindTag(t *testing.T) {
+	spr := Aseprite{Tags: []Tag{
+		{Name: "walk", Lo: 0, Hi: 1},
+		{Name: "run", Lo: 2, Hi: 3},
+		{Name: "walk", Lo: 4, Hi: 5},
+	}}
+
+	for _, tt := range []struct {
+		Name  string
+		Found bool
+		Lo    uint16
+		Count int
+	}{
+		{"walk", true, 0, 2},
+		{"run", true, 2, 1},
+		{"jump", false, 0, 0},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			tag, ok := spr.FindTag(tt.Name)
+			require.True(t, ok == tt.Found, "found")
+			require.True(t, tag.Lo == tt.Lo, "first", tag)
+
+			tags := spr.FindTags(tt.Name)
+			require.True(t, len(tags) == tt.Count, "count", tags)
+			for _, tag := range tags {
+				require.True(t, tag.Name == tt.Name, "name", tag)
+			}
+		})
+	}
+}
+
+func TestTagFrames(t *testing.T) {
+	const ms = time.Millisecond
+	spr := testSprite(100*ms, 50*ms, 200*ms, 0, 100*ms)
+
+	for _, tt := range []struct {
+		Name     string
+		Tag      Tag
+		Frames   []int
+		Duration time.Duration
+	}{
+		{"forward", Tag{Lo: 0, Hi: 2}, []int{0, 1, 2}, 350 * ms},
+		{"forward_twice", Tag{Lo: 1, Hi: 2, Repeat: 2}, []int{1, 2, 1, 2}, 500 * ms},
+		{"reverse", Tag{Lo: 0, Hi: 2, LoopDirection: Reverse}, []int{2, 1, 0}, 350 * ms},
+		{"pingpong", Tag{Lo: 0, Hi: 2, LoopDirection: PingPong}, []int{0, 1, 2, 1}, 400 * ms},
+		{"pingpong_thrice", Tag{Lo: 0, Hi: 2, LoopDirection: PingPong, Repeat: 3}, []int{0, 1, 2, 1, 0, 1, 2}, 750 * ms},
+		{"pingpong_reverse", Tag{Lo: 0, Hi: 2, LoopDirection: PingPongReverse}, []int{2, 1, 0, 1}, 400 * ms},
+		{"single", Tag{Lo: 4, Hi: 4}, []int{4}, 100 * ms},
+		// frames last at least a millisecond
+		{"short", Tag{Lo: 3, Hi: 4, Repeat: 1}, []int{3, 4}, 101 * ms},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			frames := spr.TagFrames(tt.Tag)
+			require.True(t, len(frames) == len(tt.Frames), "length", frames)
+			for i := range frames {
+				require.True(t, frames[i] == tt.Frames[i], "frame", i, frames)
+			}
+
+			d := spr.TagDuration(tt.Tag)
+			require.True(t, d == tt.Duration, "duration", d)
+		})
+	}
+}
+
+func TestTagFrameAt(t *testing.T) {
+	const ms = time.Millisecond
+	spr := testSprite(100*ms, 50*ms, 200*ms, 0, 100*ms)
+
+	for _, tt := range []struct {
+		Name   string
+		Tag    Tag
+		Offset time.Duration
+		Frame  int
+	}{
+		{"start", Tag{Lo: 0, Hi: 2}, 0, 0},
+		{"negative", Tag{Lo: 0, Hi: 2}, -10 * ms, 0},
+		{"middle", Tag{Lo: 0, Hi: 2}, 120 * ms, 1},
+		{"boundary", Tag{Lo: 0, Hi: 2}, 150 * ms, 2},
+		{"wrap", Tag{Lo: 0, Hi: 2}, 360 * ms, 0},
+		{"pingpong_back", Tag{Lo: 0, Hi: 2, LoopDirection: PingPong}, 360 * ms, 1},
+		{"pingpong_wrap", Tag{Lo: 0, Hi: 2, LoopDirection: PingPong}, 400 * ms, 0},
+		{"reverse", Tag{Lo: 0, Hi: 2, LoopDirection: Reverse}, 210 * ms, 1},
+		{"repeat", Tag{Lo: 1, Hi: 2, Repeat: 2}, 260 * ms, 1},
+		{"finished", Tag{Lo: 1, Hi: 2, Repeat: 2}, time.Hour, 2},
+		{"pingpong_finished", Tag{Lo: 0, Hi: 2, LoopDirection: PingPong, Repeat: 2}, time.Hour, 0},
+		{"short", Tag{Lo: 3, Hi: 4}, 1 * ms, 4},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			i := spr.TagFrameAt(tt.Tag, tt.Offset)
+			require.True(t, i == tt.Frame, "frame", i)
+		})
+	}
+}
+
+func TestTagOutOfRange(t *testing.T) {
+	spr := testSprite(time.Millisecond, time.Millisecond)
+
+	for _, tag := range []Tag{
+		{Lo: 1, Hi: 0},
+		{Lo: 1, Hi: 2},
+		{Lo: 0, Hi: 65535, Repeat: 2},
+	} {
+		require.True(t, spr.TagFrames(tag) == nil, "frames", tag)
+		require.True(t, spr.TagDuration(tag) == 0, "duration", tag)
+		require.True(t, spr.TagFrameAt(tag, 0) == -1, "frame", tag)
+	}
+
+	require.True(t, (&Aseprite{}).TagFrames(Tag{}) == nil, "no frames")
+}
+
+func TestTagTree(t *testing.T) {
+	spr := Aseprite{Tags: []Tag{
+		{Name: "all", Lo: 0, Hi: 9},
+		{Name: "a", Lo: 1, Hi: 4},
+		{Name: "b", Lo: 2, Hi: 3},
+		// overlaps a
+		{Name: "c", Lo: 3, Hi: 6},
+		// same frames as a
+		{Name: "d", Lo: 1, Hi: 4},
+		{Name: "e", Lo: 8, Hi: 9},
+	}}
+
+	var names func(nodes []*TagNode) string
+	names = func(nodes []*TagNode) string {
+		var s string
+		for _, n := range nodes {
+			require.True(t, spr.Tags[n.Index].Name == n.Tag.Name, "index", n.Index)
+			s += n.Tag.Name
+			if len(n.Children) > 0 {
+				s += "(" + names(n.Children) + ")"
+			}
+		}
+		return s
+	}
+
+	tree := names(spr.TagTree())
+	require.True(t, tree == "all(a(b)dce)", tree)
+}
+
+func TestTagFramesNested(t *testing.T) {
+	const ms = time.Millisecond
+	spr := testSprite(100*ms, 100*ms, 100*ms, 100*ms, 100*ms, 100*ms)
+	spr.Tags = []Tag{
+		{Name: "outer", Lo: 0, Hi: 5},
+		{Name: "twice", Lo: 1, Hi: 2, Repeat: 2},
+		{Name: "forever", Lo: 4, Hi: 5, LoopDirection: PingPong},
+	}
+
+	for _, tt := range []struct {
+		Name   string
+		Tag    Tag
+		Frames []int
+	}{
+		{"forward", Tag{Lo: 0, Hi: 5, Repeat: 1}, []int{0, 1, 2, 1, 2, 3, 4, 5}},
+		{"reverse", Tag{Lo: 0, Hi: 5, LoopDirection: Reverse, Repeat: 1}, []int{4, 5, 3, 1, 2, 1, 2, 0}},
+		{"pingpong", Tag{Lo: 0, Hi: 5, LoopDirection: PingPong, Repeat: 2}, []int{0, 1, 2, 1, 2, 3, 4, 5, 4, 3, 1, 2, 1, 2, 0}},
+		{"inner", spr.Tags[1], []int{1, 2, 1, 2}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			frames := spr.TagFrames(tt.Tag)
+			require.True(t, len(frames) == len(tt.Frames), "length", frames)
+			for i := range frames {
+				require.True(t, frames[i] == tt.Frames[i], "frame", i, frames)
+			}
+		})
+	}
+
+	// the frames of animations that repeat forever match the player
+	for _, dir := range []LoopDirection{Forward, Reverse, PingPong, PingPongReverse} {
+		tag := Tag{Lo: 0, Hi: 5, LoopDirection: dir}
+		p, err := NewPlayer(spr, &tag)
+		require.NoError(t, err)
+
+		for offset := time.Duration(0); offset < 5*time.Second; offset += 100 * ms {
+			i := spr.TagFrameAt(tag, offset)
+			require.True(t, i == p.Frame(), "frame", dir, offset, i, p.Frame())
+			p.Update(100 * ms)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+#!/bin/sh
+# Exports the golden images of the blend mode tests with Aseprite.
+#
+# blendmodes.aseprite has a backdrop layer and one source layer per blend mode.
+# Every frame draws the source layers with a different cel opacity.
+# Each source layer is exported together with the backdrop as
+# blendmodes/<mode>-<frame>.png, with frames counted from 0.
+set -e
+cd "$(dirname "$0")"
+
+ASEPRITE=${ASEPRITE:-aseprite}
+
+for mode in normal multiply screen overlay darken lighten \
+	color_dodge color_burn hard_light soft_light difference \
+	exclusion hue saturation color luminosity addition subtract divide; do
+	for frame in 0 1 2 3; do
+		"$ASEPRITE" -b --layer backdrop --layer "$mode" --frame-range "$frame,$frame" \
+			blendmodes.aseprite --save-as "blendmodes/$mode-$frame.png"
+	done
+done